@@ -4,6 +4,8 @@ import (
 	"container/heap"
 	"fmt"
 	"math"
+	"os"
+	"solution1/pkg/graph"
 	"solution1/pkg/loader"
 	"solution1/pkg/types"
 	"solution1/pqueue"
@@ -37,14 +39,24 @@ func (m Movement) Print() {
 }
 
 func main() {
-	train, pkg, g := loader.Initialize("example.txt")
+	problem, err := loader.Initialize("example.txt")
+	if err == nil {
+		err = loader.Validate(problem)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	train, pkg, g := problem.Train, problem.Package, problem.Graph
+	// Shortest paths between the stations, computed once instead of on every assignment
+	paths := graph.New(g)
 	movement := Movement{Move: make([]Move, 0), TimeTaken: 0}
 	// Queue for the assignment. The assignment are store by chunk, each chunk contain assignment of multiple trains at a point of time.
 	// All assignment are being execute sequentially.
 	queue := make([][]pqueue.Assignment, 0)
 
 	// Assign first package to each train
-	assignment := assignPackage(pkg, train, g)
+	assignment := assignPackage(pkg, train, paths)
 	a := make([]pqueue.Assignment, len(assignment))
 	i := 0
 	for _, each := range assignment {
@@ -74,7 +86,7 @@ func main() {
 			}
 		}
 		asn := make([]pqueue.Assignment, 0)
-		for _, as := range deliveryOrPickUp(pkg, train, g) {
+		for _, as := range deliveryOrPickUp(pkg, train, paths) {
 			if as.Action != -1 {
 				asn = append(asn, as)
 			}
@@ -86,52 +98,8 @@ func main() {
 	movement.Print()
 }
 
-// Djikstra shortest distance
-func shortest(graph types.Graph, start, end string) (int, []string) {
-	pq := make(pqueue.DistancePQ, len(graph))
-	duration := make(map[string]int)
-	prev := make(map[string]string)
-
-	i := 0
-	for v := range graph {
-		duration[v] = math.MaxInt32
-		if v == start {
-			duration[v] = 0
-		}
-		pq[i] = &pqueue.Node{Name: v, Duration: duration[v]}
-		i++
-	}
-
-	heap.Init(&pq)
-
-	for pq.Len() > 0 {
-		node := heap.Pop(&pq).(*pqueue.Node)
-		for dest, dur := range graph[node.Name] {
-			alt := duration[node.Name] + dur
-			if alt < duration[dest] {
-				duration[dest] = alt
-				prev[dest] = node.Name
-				for i := 0; i < pq.Len(); i++ {
-					if pq[i].Name == dest {
-						pq[i].Duration = alt
-						heap.Fix(&pq, i)
-					}
-				}
-			}
-		}
-	}
-
-	path := make([]string, 0)
-	temp := end
-	for temp != "" {
-		path = append([]string{temp}, path...)
-		temp = prev[temp]
-	}
-	return duration[end], path
-}
-
 // Assign closest package to train
-func assignPackage(pkg map[string]*types.Package, train map[string]*types.Train, graph types.Graph) map[string]pqueue.Assignment {
+func assignPackage(pkg map[string]*types.Package, train map[string]*types.Train, paths *graph.Graph) map[string]pqueue.Assignment {
 	assignment := make(map[string]pqueue.Assignment)
 	pq := make(pqueue.AssignmentPQ, 0)
 	heap.Init(&pq)
@@ -143,7 +111,7 @@ func assignPackage(pkg map[string]*types.Package, train map[string]*types.Train,
 			if p.Picked {
 				continue
 			}
-			dist, path := shortest(graph, t.CurrentLocation, p.StartAt)
+			dist, path := paths.Shortest(t.CurrentLocation, p.StartAt)
 			if t.CurrentCapacity >= p.Weight {
 				// If there's only one train, we don't need to worry about optimal assignment on weight and distance for difference train
 				// If there's only one train, just go with the closest package at the time.
@@ -257,10 +225,10 @@ func dropOffPackage(train *types.Train, pkg *types.Package, graph types.Graph, p
 }
 
 // Function to decide whether the next assignment should be delivering picked up package or conitnue pick up next package.
-func deliveryOrPickUp(pkg map[string]*types.Package, train map[string]*types.Train, graph types.Graph) map[string]pqueue.Assignment {
+func deliveryOrPickUp(pkg map[string]*types.Package, train map[string]*types.Train, paths *graph.Graph) map[string]pqueue.Assignment {
 	a := make(map[string]pqueue.Assignment)
 	// Get assignment of next package
-	asgn := assignPackage(pkg, train, graph)
+	asgn := assignPackage(pkg, train, paths)
 	// Check if the next assignment for each train is optimal choice or not
 	// Compare if the next assignment or deliver the picked up package is use  lesser time
 	for _, t := range train {
@@ -281,7 +249,7 @@ func deliveryOrPickUp(pkg map[string]*types.Package, train map[string]*types.Tra
 		// to deliver.
 		if len(t.PickedPackage) > 0 {
 			for _, each := range t.PickedPackage {
-				deliverDist, deliverPath := shortest(graph, t.CurrentLocation, pkg[each].Destination)
+				deliverDist, deliverPath := paths.Shortest(t.CurrentLocation, pkg[each].Destination)
 				if deliverDist < minDist {
 					minAction = DeliverToDestination
 					minDist = deliverDist
@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"math"
+	"solution1/pkg/types"
+	"solution1/pqueue"
+	"sync"
+)
+
+// Distance between stations which are not connected
+const Unreachable = math.MaxInt32
+
+// Graphs with up to this many stations compute all distances at once with Floyd-Warshall, larger ones run
+// Dijkstra from a station the first time a distance from it is needed
+const floydWarshallLimit = 200
+
+// Graph caches the shortest distance and the previous station on the shortest path between every pair of stations.
+// The cache is filled on the first lookup. It is safe for concurrent use.
+type Graph struct {
+	mu sync.Mutex
+	// Stations numbered in sorted order, so that ties between paths are always broken the same way
+	network *types.Network
+	// Shortest distance and previous station on the shortest path, by source station, nil until computed
+	rows []*row
+}
+
+type row struct {
+	dist []int
+	prev []int
+}
+
+// New creates a graph of the edges
+func New(edges types.Graph) *Graph {
+	network := types.NewNetwork(edges)
+	return &Graph{network: network, rows: make([]*row, network.Len())}
+}
+
+// Distance is the time of the shortest path between two stations, Unreachable when there is none
+func (g *Graph) Distance(from, to string) int {
+	r, j, ok := g.lookup(from, to)
+	if !ok {
+		return Unreachable
+	}
+	return r.dist[j]
+}
+
+// Path is the shortest path between two stations, both included, nil when there is none
+func (g *Graph) Path(from, to string) []string {
+	r, j, ok := g.lookup(from, to)
+	if !ok || r.dist[j] == Unreachable {
+		return nil
+	}
+
+	length := 1
+	for v := j; r.prev[v] >= 0; v = r.prev[v] {
+		length++
+	}
+	path := make([]string, length)
+	for v := j; v >= 0; v = r.prev[v] {
+		length--
+		path[length] = g.network.Name(v)
+	}
+	return path
+}
+
+// Shortest returns the distance and the path between two stations
+func (g *Graph) Shortest(from, to string) (int, []string) {
+	return g.Distance(from, to), g.Path(from, to)
+}
+
+// Row of the source station and index of the target, false when either station is unknown
+func (g *Graph) lookup(from, to string) (*row, int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	i, ok := g.network.ID(from)
+	if !ok {
+		return nil, 0, false
+	}
+	j, ok := g.network.ID(to)
+	if !ok {
+		return nil, 0, false
+	}
+
+	if g.rows[i] == nil {
+		if g.network.Len() <= floydWarshallLimit {
+			g.floydWarshall()
+		} else {
+			g.rows[i] = g.dijkstra(i)
+		}
+	}
+	return g.rows[i], j, true
+}
+
+func newRow(n, source int) *row {
+	r := &row{dist: make([]int, n), prev: make([]int, n)}
+	for i := range r.dist {
+		r.dist[i] = Unreachable
+		r.prev[i] = -1
+	}
+	r.dist[source] = 0
+	return r
+}
+
+// Fill every row at once
+func (g *Graph) floydWarshall() {
+	n := g.network.Len()
+	for i := range g.rows {
+		g.rows[i] = newRow(n, i)
+		targets, weights := g.network.Neighbours(i)
+		for e, j := range targets {
+			if w := weights[e]; i != j && w < g.rows[i].dist[j] {
+				g.rows[i].dist[j] = w
+				g.rows[i].prev[j] = i
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		through := g.rows[k]
+		for i := 0; i < n; i++ {
+			r := g.rows[i]
+			if r.dist[k] == Unreachable {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if through.dist[j] == Unreachable {
+					continue
+				}
+				if d := r.dist[k] + through.dist[j]; d < r.dist[j] {
+					r.dist[j] = d
+					r.prev[j] = through.prev[j]
+				}
+			}
+		}
+	}
+}
+
+// Row of a single source
+func (g *Graph) dijkstra(source int) *row {
+	r := newRow(g.network.Len(), source)
+	pq := pqueue.NewIndexedPQ(g.network.Len())
+	pq.Push(source, 0)
+
+	for pq.Len() > 0 {
+		u, _ := pq.Pop()
+		targets, weights := g.network.Neighbours(u)
+		for e, v := range targets {
+			alt := r.dist[u] + weights[e]
+			if alt >= r.dist[v] {
+				continue
+			}
+			r.dist[v] = alt
+			r.prev[v] = u
+			if pq.Contains(v) {
+				pq.DecreaseKey(v, alt)
+			} else {
+				pq.Push(v, alt)
+			}
+		}
+	}
+	return r
+}
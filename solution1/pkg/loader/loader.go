@@ -2,103 +2,208 @@ package loader
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"solution1/pkg/types"
 	"strconv"
 	"strings"
 )
 
-func Initialize(path string) (map[string]*types.Train, map[string]*types.Package, types.Graph) {
-	// Initialize variables
-	var numStations, numEdges, numDeliveries, numTrains int
-	var err error
-	// Open file
+// Sections of the input file, used to report where a parse error happened
+const (
+	SectionStations   = "stations"
+	SectionEdges      = "edges"
+	SectionDeliveries = "deliveries"
+	SectionTrains     = "trains"
+)
+
+var (
+	ErrUnexpectedEOF = errors.New("unexpected end of input")
+	ErrFieldCount    = errors.New("wrong number of fields")
+)
+
+// ParseError reports a malformed line in the input together with the section and field it belongs to.
+type ParseError struct {
+	Line    int
+	Section string
+	Field   string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s: invalid %s: %v", e.Line, e.Section, e.Field, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Initialize reads the problem from the file at path
+func Initialize(path string) (types.Problem, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		panic(fmt.Sprintln("Error opening file:", err))
+		return types.Problem{}, fmt.Errorf("open %s: %w", path, err)
 	}
-	scanner := bufio.NewScanner(file)
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// Parse reads the problem from r
+func Parse(r io.Reader) (types.Problem, error) {
+	in := &lineReader{scanner: bufio.NewScanner(r)}
 	graph := make(types.Graph)
+	problem := types.Problem{Graph: graph}
 
-	// Read number of stations
-	scanner.Scan()
-	numStations, err = strconv.Atoi(scanner.Text())
+	// Read station names
+	numStations, err := in.count(SectionStations)
 	if err != nil {
-		panic(fmt.Sprintln("Error reading number of stations:", err))
+		return types.Problem{}, err
 	}
-	// Read station names
 	for i := 0; i < numStations; i++ {
-		scanner.Scan()
-		graph[scanner.Text()] = make(map[string]int)
+		name, err := in.next(SectionStations, "name")
+		if err != nil {
+			return types.Problem{}, err
+		}
+		graph[name] = make(map[string]int)
+		problem.Stations = append(problem.Stations, name)
 	}
 
-	// skip next line
-	scanner.Scan()
-
-	// Read number of edges
-	scanner.Scan()
-	numEdges, err = strconv.Atoi(scanner.Text())
+	// Read edges
+	numEdges, err := in.count(SectionEdges)
 	if err != nil {
-		panic(fmt.Sprintln("Error reading number of edges:", err))
+		return types.Problem{}, err
 	}
-	// Read edges
 	for i := 0; i < numEdges; i++ {
-		scanner.Scan()
-		edgeInfo := strings.Split(scanner.Text(), ",")
-
-		weight, err := strconv.Atoi(edgeInfo[3])
+		edgeInfo, err := in.fields(SectionEdges, "edge", 4)
+		if err != nil {
+			return types.Problem{}, err
+		}
+		weight, err := in.atoi(SectionEdges, "weight", edgeInfo[3])
 		if err != nil {
-			panic(fmt.Sprintln("Error reading edge weight:", err))
+			return types.Problem{}, err
 		}
 
+		// Stations missing from the station list are left for validation to report
+		for _, station := range edgeInfo[1:3] {
+			if _, ok := graph[station]; !ok {
+				graph[station] = make(map[string]int)
+			}
+		}
 		graph[edgeInfo[1]][edgeInfo[2]] = weight
 		graph[edgeInfo[1]][edgeInfo[1]] = 0
 		graph[edgeInfo[2]][edgeInfo[1]] = weight
+		problem.Edges = append(problem.Edges, types.Edge{Name: edgeInfo[0], From: edgeInfo[1], To: edgeInfo[2], Weight: weight})
 	}
 
-	// skip next line
-	scanner.Scan()
-
-	// Read number of deliveries
-	scanner.Scan()
-	numDeliveries, err = strconv.Atoi(scanner.Text())
+	// Read deliveries
+	numDeliveries, err := in.count(SectionDeliveries)
 	if err != nil {
-		panic(fmt.Sprintln("Error reading number of deliveries:", err))
+		return types.Problem{}, err
 	}
-
-	// Read deliveries
 	pkg := make(map[string]*types.Package)
 	for i := 0; i < numDeliveries; i++ {
-		scanner.Scan()
-		deliveryInfo := strings.Split(scanner.Text(), ",")
-		weight, err := strconv.Atoi(deliveryInfo[1])
+		deliveryInfo, err := in.fields(SectionDeliveries, "delivery", 4)
 		if err != nil {
-			panic(fmt.Sprintln("Error reading package weight:", err))
+			return types.Problem{}, err
 		}
-		pkg[deliveryInfo[0]] = &types.Package{Name: deliveryInfo[0], Weight: weight, StartAt: deliveryInfo[2], Destination: deliveryInfo[3]}
+		weight, err := in.atoi(SectionDeliveries, "weight", deliveryInfo[1])
+		if err != nil {
+			return types.Problem{}, err
+		}
+		p := &types.Package{Name: deliveryInfo[0], Weight: weight, StartAt: deliveryInfo[2], Destination: deliveryInfo[3]}
+		pkg[p.Name] = p
+		problem.Packages = append(problem.Packages, p)
 	}
 
-	// skip next line
-	scanner.Scan()
-
-	// Read number of trains
-	scanner.Scan()
-	numTrains, err = strconv.Atoi(scanner.Text())
+	// Read trains
+	numTrains, err := in.count(SectionTrains)
 	if err != nil {
-		panic(fmt.Sprintln("Error reading number of trains:", err))
+		return types.Problem{}, err
 	}
-
-	// Read trains
 	train := make(map[string]*types.Train)
 	for i := 0; i < numTrains; i++ {
-		scanner.Scan()
-		trainInfo := strings.Split(scanner.Text(), ",")
-		capacity, err := strconv.Atoi(trainInfo[1])
+		trainInfo, err := in.fields(SectionTrains, "train", 3)
+		if err != nil {
+			return types.Problem{}, err
+		}
+		capacity, err := in.atoi(SectionTrains, "capacity", trainInfo[1])
+		if err != nil {
+			return types.Problem{}, err
+		}
+		t := &types.Train{Capacity: capacity, CurrentLocation: trainInfo[2], Name: trainInfo[0], CurrentCapacity: capacity, PickedPackage: make([]string, 0), DroppedPackage: make([]string, 0)}
+		train[t.Name] = t
+		problem.Trains = append(problem.Trains, t)
+	}
+	problem.Train = train
+	problem.Package = pkg
+	problem.Network = types.NewNetwork(graph)
+	return problem, nil
+}
+
+// lineReader keeps track of the line number while scanning the input
+type lineReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Read the next line
+func (r *lineReader) next(section, field string) (string, error) {
+	if !r.scanner.Scan() {
+		err := r.scanner.Err()
+		if err == nil {
+			err = ErrUnexpectedEOF
+		}
+		return "", &ParseError{Line: r.line + 1, Section: section, Field: field, Err: err}
+	}
+	r.line++
+	return strings.TrimSpace(r.scanner.Text()), nil
+}
+
+// Read the number of entries of a section, skipping the blank lines in between sections
+func (r *lineReader) count(section string) (int, error) {
+	for {
+		text, err := r.next(section, "count")
+		if err != nil {
+			return 0, err
+		}
+		if text == "" {
+			continue
+		}
+		n, err := r.atoi(section, "count", text)
 		if err != nil {
-			panic(fmt.Sprintln("Error reading train capacity:", err))
+			return 0, err
 		}
-		train[trainInfo[0]] = &types.Train{Capacity: capacity, CurrentLocation: trainInfo[2], Name: trainInfo[0], CurrentCapacity: capacity, PickedPackage: make([]string, 0), DroppedPackage: make([]string, 0)}
+		if n < 0 {
+			return 0, &ParseError{Line: r.line, Section: section, Field: "count", Err: fmt.Errorf("negative count %d", n)}
+		}
+		return n, nil
+	}
+}
+
+// Read the next line as n comma separated fields
+func (r *lineReader) fields(section, field string, n int) ([]string, error) {
+	text, err := r.next(section, field)
+	if err != nil {
+		return nil, err
+	}
+	info := strings.Split(text, ",")
+	if len(info) != n {
+		return nil, &ParseError{Line: r.line, Section: section, Field: field, Err: fmt.Errorf("%w: expected %d, got %d", ErrFieldCount, n, len(info))}
+	}
+	for i := range info {
+		info[i] = strings.TrimSpace(info[i])
+	}
+	return info, nil
+}
+
+// Parse an integer field of the current line
+func (r *lineReader) atoi(section, field, text string) (int, error) {
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, &ParseError{Line: r.line, Section: section, Field: field, Err: err}
 	}
-	return train, pkg, graph
+	return n, nil
 }
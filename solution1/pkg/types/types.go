@@ -11,6 +11,13 @@ type Train struct {
 
 type Graph map[string]map[string]int
 
+type Edge struct {
+	Name   string
+	From   string
+	To     string
+	Weight int
+}
+
 type Package struct {
 	Weight      int
 	StartAt     string
@@ -18,3 +25,18 @@ type Package struct {
 	Name        string
 	Picked      bool
 }
+
+// Problem holds everything loaded from an input file
+type Problem struct {
+	// Entries as declared in the file, in order and including duplicates
+	Stations []string
+	Edges    []Edge
+	Packages []*Package
+	Trains   []*Train
+
+	Graph   Graph
+	Train   map[string]*Train
+	Package map[string]*Package
+	// The graph with numbered stations, for the solvers
+	Network *Network
+}
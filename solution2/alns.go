@@ -0,0 +1,212 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"solution2/alns"
+	"solution2/anneal"
+	"solution2/graph"
+	"sort"
+)
+
+// Plan with some packages taken off their trains, waiting to be inserted again
+type partialState struct {
+	State
+	removed []string
+}
+
+// Cost of inserting a package into a train at a position of its sequence
+type insertion struct {
+	train    string
+	position int
+	cost     int
+}
+
+// Estimated time for the train to deliver the sequence of packages one after another along the shortest paths
+func sequenceTime(paths *graph.Graph, s State, train string, sequence []string) int {
+	timeTaken := 0
+	location := s.Train[train].StartAt
+	for _, p := range sequence {
+		timeTaken += paths.Distance(location, s.Package[p].StartAt) + paths.Distance(s.Package[p].StartAt, s.Package[p].Destination)
+		location = s.Package[p].Destination
+	}
+	return timeTaken
+}
+
+// Destroy and repair operators for the adaptive large neighbourhood search.
+// Costs are estimated with the shortest distances between the stations.
+func alnsOperators(paths *graph.Graph) ([]alns.Destroy, []alns.Repair) {
+
+	destroy := []alns.Destroy{
+		{Name: "random", Apply: func(s anneal.State, r *rand.Rand) alns.Partial {
+			state := s.(State)
+			pkgs := sortedKeys(state.Package)
+			r.Shuffle(len(pkgs), func(i, j int) {
+				pkgs[i], pkgs[j] = pkgs[j], pkgs[i]
+			})
+			return state.remove(pkgs[:removalCount(len(pkgs), r)])
+		}},
+		// Remove the packages which save the most time when taken off their train
+		{Name: "worst", Apply: func(s anneal.State, r *rand.Rand) alns.Partial {
+			state := s.(State)
+			saving := make(map[string]int)
+			for _, t := range sortedKeys(state.TrainAssignment) {
+				sequence := state.TrainAssignment[t]
+				full := sequenceTime(paths, state, t, sequence)
+				for i, p := range sequence {
+					without := append(append([]string{}, sequence[:i]...), sequence[i+1:]...)
+					saving[p] = full - sequenceTime(paths, state, t, without)
+				}
+			}
+			pkgs := sortedKeys(state.Package)
+			sort.SliceStable(pkgs, func(i, j int) bool {
+				return saving[pkgs[i]] > saving[pkgs[j]]
+			})
+			return state.remove(pkgs[:removalCount(len(pkgs), r)])
+		}},
+		// Remove a random package and the packages whose pickup and destination stations are closest to its own (Shaw removal)
+		{Name: "related", Apply: func(s anneal.State, r *rand.Rand) alns.Partial {
+			state := s.(State)
+			pkgs := sortedKeys(state.Package)
+			seed := state.Package[pkgs[r.Intn(len(pkgs))]]
+			relatedness := make(map[string]int)
+			for _, p := range pkgs {
+				other := state.Package[p]
+				relatedness[p] = paths.Distance(seed.StartAt, other.StartAt) + paths.Distance(other.StartAt, seed.StartAt) +
+					paths.Distance(seed.Destination, other.Destination) + paths.Distance(other.Destination, seed.Destination)
+			}
+			sort.SliceStable(pkgs, func(i, j int) bool {
+				return relatedness[pkgs[i]] < relatedness[pkgs[j]]
+			})
+			return state.remove(pkgs[:removalCount(len(pkgs), r)])
+		}},
+	}
+
+	repair := []alns.Repair{
+		// Insert the package with the cheapest insertion first
+		{Name: "greedy", Apply: func(p alns.Partial, r *rand.Rand) anneal.State {
+			return p.(partialState).insert(paths, r, func(options []insertion) float64 {
+				return -float64(options[0].cost)
+			})
+		}},
+		// Insert the package which loses the most by not getting its best train first, looking at its 2 and 3 best trains
+		{Name: "regret-2", Apply: func(p alns.Partial, r *rand.Rand) anneal.State {
+			return p.(partialState).insert(paths, r, regret(2))
+		}},
+		{Name: "regret-3", Apply: func(p alns.Partial, r *rand.Rand) anneal.State {
+			return p.(partialState).insert(paths, r, regret(3))
+		}},
+	}
+	return destroy, repair
+}
+
+// Number of packages to remove, between 1 and half of them
+func removalCount(n int, r *rand.Rand) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + r.Intn(int(math.Max(1, float64(n/2))))
+}
+
+// Regret of not inserting a package on its best train, summed over its k best trains.
+// Packages which fit on fewer than k trains come first.
+func regret(k int) func(options []insertion) float64 {
+	return func(options []insertion) float64 {
+		if len(options) < k {
+			return math.Inf(1)
+		}
+		var sum float64
+		for _, each := range options[1:k] {
+			sum += float64(each.cost - options[0].cost)
+		}
+		return sum
+	}
+}
+
+// Copy of the state with the packages taken off their trains
+func (s State) remove(pkgs []string) partialState {
+	newState := s.clone()
+	removed := make(map[string]bool, len(pkgs))
+	for _, p := range pkgs {
+		removed[p] = true
+	}
+	for t, sequence := range newState.TrainAssignment {
+		kept := make([]string, 0, len(sequence))
+		for _, p := range sequence {
+			if !removed[p] {
+				kept = append(kept, p)
+			}
+		}
+		newState.TrainAssignment[t] = kept
+	}
+	return partialState{State: newState, removed: append([]string{}, pkgs...)}
+}
+
+// Insert the removed packages one at a time, the package with the highest priority first at its cheapest position,
+// then plan the routes of the complete state. The repair fails with nil when a package fits on no train that reaches it.
+// priority gets the insertions of a package on every train that can take it, cheapest first.
+func (ps partialState) insert(paths *graph.Graph, r *rand.Rand, priority func(options []insertion) float64) anneal.State {
+	s := ps.State
+	removed := append([]string{}, ps.removed...)
+	for len(removed) > 0 {
+		next, nextPriority := -1, math.Inf(-1)
+		var nextOption insertion
+		for i, p := range removed {
+			options := s.insertions(paths, p)
+			if len(options) == 0 {
+				continue
+			}
+			if value := priority(options); next == -1 || value > nextPriority ||
+				(value == nextPriority && options[0].cost < nextOption.cost) {
+				next, nextPriority, nextOption = i, value, options[0]
+			}
+		}
+		// None of the packages left fits on the capacity the trains have left
+		if next == -1 {
+			return nil
+		}
+
+		p := removed[next]
+		sequence := s.TrainAssignment[nextOption.train]
+		s.TrainAssignment[nextOption.train] = append(append(append([]string{}, sequence[:nextOption.position]...), p), sequence[nextOption.position:]...)
+		removed = append(removed[:next], removed[next+1:]...)
+	}
+
+	route, move, err := planRoute(s.Router, s.TrainAssignment, s.Deferred, s.Train, r)
+	if err != nil {
+		return nil
+	}
+	s.Route, s.Move = route, move
+	return s
+}
+
+// Cheapest insertion of the package on every train with enough capacity left which reaches it, cheapest train first
+func (s State) insertions(paths *graph.Graph, p string) []insertion {
+	trains := sortedKeys(s.Train)
+	weight := s.Package[p].Weight
+
+	candidate := make([]string, 0, len(trains))
+	for _, t := range trains {
+		if s.load(t)+weight <= s.Train[t].Capacity && s.Router.reaches(s.Train[t], s.Package[p]) {
+			candidate = append(candidate, t)
+		}
+	}
+
+	options := make([]insertion, 0, len(candidate))
+	for _, t := range candidate {
+		sequence := s.TrainAssignment[t]
+		current := sequenceTime(paths, s, t, sequence)
+		best := insertion{train: t, cost: math.MaxInt}
+		for i := 0; i <= len(sequence); i++ {
+			inserted := append(append(append([]string{}, sequence[:i]...), p), sequence[i:]...)
+			if cost := sequenceTime(paths, s, t, inserted) - current; cost < best.cost {
+				best.position, best.cost = i, cost
+			}
+		}
+		options = append(options, best)
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].cost < options[j].cost
+	})
+	return options
+}
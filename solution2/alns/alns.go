@@ -0,0 +1,156 @@
+package alns
+
+import (
+	"context"
+	"math/rand"
+	"solution2/anneal"
+)
+
+// Partial is a solution with some of its parts removed by a destroy operator, waiting to be repaired
+type Partial interface{}
+
+// Destroy removes part of a solution
+type Destroy struct {
+	Name  string
+	Apply func(s anneal.State, r *rand.Rand) Partial
+}
+
+// Repair puts the removed parts back into a partial solution. Apply returns nil when they cannot all be put back,
+// which counts as a rejected solution.
+type Repair struct {
+	Name  string
+	Apply func(p Partial, r *rand.Rand) anneal.State
+}
+
+// Config of a search. The embedded annealing config sets the iteration budget, seed, time budget and the
+// temperature and cooling schedule used to accept worse solutions, Reheat and Restart are not used.
+type Config struct {
+	anneal.Config
+	Destroy []Destroy
+	Repair  []Repair
+	// Number of iterations after which the operator weights are updated from their scores, defaults to 100
+	Segment uint
+	// Share of the new weight taken from the scores of the last segment, defaults to 0.1
+	Reaction float64
+	// Score of an operator pair for finding a new best solution, a better solution than the current one, and an
+	// accepted worse solution. Defaults to 33, 9 and 13.
+	Scores [3]float64
+}
+
+// Roulette wheel of operators, picked with a probability proportional to their weight
+type wheel struct {
+	weight []float64
+	score  []float64
+	used   []uint
+}
+
+func newWheel(n int) *wheel {
+	w := &wheel{weight: make([]float64, n), score: make([]float64, n), used: make([]uint, n)}
+	for i := range w.weight {
+		w.weight[i] = 1
+	}
+	return w
+}
+
+func (w *wheel) pick(r *rand.Rand) int {
+	var sum float64
+	for _, each := range w.weight {
+		sum += each
+	}
+	x := r.Float64() * sum
+	for i, each := range w.weight {
+		if x < each {
+			return i
+		}
+		x -= each
+	}
+	return len(w.weight) - 1
+}
+
+// Blend the average score of every operator used in the last segment into its weight
+func (w *wheel) update(reaction float64) {
+	for i := range w.weight {
+		if w.used[i] > 0 {
+			w.weight[i] = (1-reaction)*w.weight[i] + reaction*w.score[i]/float64(w.used[i])
+		}
+		w.score[i] = 0
+		w.used[i] = 0
+	}
+}
+
+// Search runs an adaptive large neighbourhood search from initial and returns the best solution found.
+// Every iteration destroys and repairs the current solution with operators picked by roulette wheel, and accepts
+// the result like simulated annealing does. Operators leading to good solutions get a higher weight over time.
+func Search(ctx context.Context, initial anneal.State, conf Config) anneal.Result {
+	if conf.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.TimeBudget)
+		defer cancel()
+	}
+	if conf.Segment == 0 {
+		conf.Segment = 100
+	}
+	if conf.Reaction == 0 {
+		conf.Reaction = 0.1
+	}
+	if conf.Scores == [3]float64{} {
+		conf.Scores = [3]float64{33, 9, 13}
+	}
+
+	r := rand.New(rand.NewSource(conf.Seed))
+	temperature, schedule := anneal.Cooling(initial, r, conf.Config)
+	progress := anneal.Progress{Iterations: conf.Iteration, Initial: temperature, AcceptanceRate: 1}
+	destroy, repair := newWheel(len(conf.Destroy)), newWheel(len(conf.Repair))
+
+	currState, currEnergy := initial, initial.Energy()
+	best := anneal.Result{State: currState, Energy: currEnergy}
+	for best.Stats.Iterations < conf.Iteration {
+		if ctx.Err() != nil {
+			best.Stopped = true
+			break
+		}
+
+		d, p := destroy.pick(r), repair.pick(r)
+		candidate := conf.Repair[p].Apply(conf.Destroy[d].Apply(currState, r), r)
+		best.Stats.Iterations++
+
+		score := 0.0
+		accepted, candidateEnergy := false, 0.0
+		if candidate != nil {
+			candidateEnergy = candidate.Energy()
+			accepted = anneal.Accept(currEnergy, candidateEnergy, temperature, r)
+		}
+		if accepted {
+			switch {
+			case candidateEnergy < best.Energy:
+				score = conf.Scores[0]
+			case candidateEnergy < currEnergy:
+				score = conf.Scores[1]
+			case candidateEnergy > currEnergy:
+				score = conf.Scores[2]
+			}
+			currState, currEnergy = candidate, candidateEnergy
+			if currEnergy < best.Energy {
+				best.State, best.Energy = currState, currEnergy
+				best.Stats.BestIteration = best.Stats.Iterations
+			}
+			best.Stats.Accepted++
+		} else {
+			best.Stats.Rejected++
+		}
+		progress.Record(accepted)
+
+		destroy.score[d] += score
+		destroy.used[d]++
+		repair.score[p] += score
+		repair.used[p]++
+		if best.Stats.Iterations%conf.Segment == 0 {
+			destroy.update(conf.Reaction)
+			repair.update(conf.Reaction)
+		}
+
+		progress.Iteration = best.Stats.Iterations
+		temperature = schedule.Next(temperature, progress)
+	}
+	return best
+}
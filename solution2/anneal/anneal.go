@@ -1,49 +1,265 @@
 package anneal
 
 import (
+	"context"
 	"math"
 	"math/rand"
+	"time"
 )
 
+// Number of neighbors sampled to calibrate the initial temperature
+const calibrationSamples = 200
+
 type State interface {
 	Energy() float64
-	Neighbor() State
+	// Neighbor returns a state close to the current one, drawing every random choice from r
+	Neighbor(r *rand.Rand) State
 	PrintMovement()
 }
 
 type Config struct {
-	Iteration       uint
+	Iteration uint
+	// Factor of the default exponential cooling, used when no Schedule is set
 	AneallingFactor float64
-	Temperature     float64
+	// Initial temperature, 0 to calibrate it from InitialAcceptance
+	Temperature float64
+	// Share of worse neighbors accepted at the start of the run when the temperature is calibrated, defaults to 0.8
+	InitialAcceptance float64
+	// Temperature at the end of the run. When set and no Schedule is given, the exponential cooling factor is
+	// derived from it and the iteration budget instead of using AneallingFactor.
+	FinalTemperature float64
+	// How the temperature goes down over the run
+	Schedule CoolingSchedule
+	// Seed of the random number generator, the same seed and initial state always give the same result
+	Seed int64
+	// Wall clock budget of the run, 0 for no limit
+	TimeBudget time.Duration
+	// Optional strategies to escape when the run freezes in a local optimum
+	Reheat  *Reheat
+	Restart *Restart
 }
 
-func Init(currState State, conf Config) State {
-	temperature := conf.Temperature
-	currEnergy := currState.Energy()
+// Reheat raises the temperature again when no better state was found for Patience iterations.
+// The temperature goes back to Ratio times the initial temperature (0.5 when unset) and the cooling schedule
+// starts over for the remaining iterations.
+type Reheat struct {
+	Patience uint
+	Ratio    float64
+}
+
+type RestartFrom int
+
+const (
+	// Restart from the best state found so far
+	RestartBest RestartFrom = iota
+	// Restart from a new state created by Restart.Fresh
+	RestartFresh
+)
 
-	// Anonymous function to update current state to new state
-	updateState := func(s State, e float64) {
-		currState = s
-		currEnergy = e
+// Restart continues the run from another state when no better state was found for Patience iterations.
+// The temperature goes back to the initial temperature and the cooling schedule starts over for the remaining iterations.
+type Restart struct {
+	Patience uint
+	From     RestartFrom
+	// Creates a new random state, required by RestartFresh
+	Fresh func(r *rand.Rand) State
+}
+
+// Stats of an annealing run
+type Stats struct {
+	Iterations uint
+	Accepted   uint
+	Rejected   uint
+	// Iteration in which the best state was found, 0 when it is the initial state
+	BestIteration uint
+	Reheats       uint
+	Restarts      uint
+	// Number of states exchanged between replicas by Tempering
+	Swaps uint
+}
+
+// Result holds the best state seen during the run and its energy
+type Result struct {
+	State  State
+	Energy float64
+	Stats  Stats
+	// Whether the run stopped before all iterations were done, because the context was cancelled or the time budget ran out
+	Stopped bool
+}
+
+// Init anneals from currState and returns the best state found.
+// The run stops early when ctx is done or the time budget runs out, the best state found so far is still returned.
+func Init(ctx context.Context, currState State, conf Config) Result {
+	if conf.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.TimeBudget)
+		defer cancel()
 	}
 
-	for i := 0; i < int(conf.Iteration); i++ {
-		// Generate neighbor state
-		neighbor := currState.Neighbor()
-		neighborEnergy := neighbor.Energy()
+	c := newChain(currState, conf)
+	c.run(ctx, conf.Iteration)
+	return c.best
+}
+
+// chain is a single annealing run, which can be advanced a number of iterations at a time
+type chain struct {
+	conf     Config
+	r        *rand.Rand
+	schedule CoolingSchedule
+	progress Progress
 
-		// Evaluate neighbor solution
-		if neighborEnergy < currEnergy {
-			// Update if neighbor is better than current
-			updateState(neighbor, neighborEnergy)
-		} else if math.Exp((currEnergy-neighborEnergy)/temperature) > rand.Float64() {
-			// Update if the acceptance probability is higher than the random number
-			updateState(neighbor, neighborEnergy)
+	temperature        float64
+	initialTemperature float64
+	// Iteration in which the cooling schedule last started over, and the number of iterations without a better state
+	scheduleStart uint
+	stale         uint
+
+	currState  State
+	currEnergy float64
+	best       Result
+}
+
+func newChain(currState State, conf Config) *chain {
+	r := rand.New(rand.NewSource(conf.Seed))
+	temperature, schedule := Cooling(currState, r, conf)
+
+	currEnergy := currState.Energy()
+	return &chain{
+		conf:               conf,
+		r:                  r,
+		schedule:           schedule,
+		progress:           Progress{Iterations: conf.Iteration, Initial: temperature, AcceptanceRate: 1},
+		temperature:        temperature,
+		initialTemperature: temperature,
+		currState:          currState,
+		currEnergy:         currEnergy,
+		best:               Result{State: currState, Energy: currEnergy},
+	}
+}
+
+// Run up to n iterations, stopping early when ctx is done
+func (c *chain) run(ctx context.Context, n uint) {
+	for i := uint(0); i < n && c.best.Stats.Iterations < c.conf.Iteration; i++ {
+		if ctx.Err() != nil {
+			c.best.Stopped = true
+			return
 		}
+		c.step()
+	}
+}
 
+// Update current state to new state
+func (c *chain) moveTo(s State, e float64) {
+	c.currState = s
+	c.currEnergy = e
+	// Keep track of the best state seen so far
+	if e < c.best.Energy {
+		c.best.State = s
+		c.best.Energy = e
+		c.best.Stats.BestIteration = c.best.Stats.Iterations
+		c.stale = 0
+	}
+}
+
+// Start the cooling schedule over from temperature t for the remaining iterations
+func (c *chain) restartSchedule(t float64) {
+	c.temperature = t
+	c.scheduleStart = c.best.Stats.Iterations
+	c.progress = Progress{Iterations: c.conf.Iteration - c.scheduleStart, Initial: t, AcceptanceRate: c.progress.AcceptanceRate}
+}
+
+func (c *chain) step() {
+	// Generate neighbor state
+	neighbor := c.currState.Neighbor(c.r)
+	neighborEnergy := neighbor.Energy()
+	c.best.Stats.Iterations++
+	c.stale++
+
+	// Evaluate neighbor solution
+	if Accept(c.currEnergy, neighborEnergy, c.temperature, c.r) {
+		c.moveTo(neighbor, neighborEnergy)
+		c.best.Stats.Accepted++
+		c.progress.Record(true)
+	} else {
+		c.best.Stats.Rejected++
+		c.progress.Record(false)
+	}
+
+	switch {
+	case c.conf.Restart != nil && c.conf.Restart.Patience > 0 && c.stale >= c.conf.Restart.Patience:
+		if c.conf.Restart.From == RestartFresh {
+			fresh := c.conf.Restart.Fresh(c.r)
+			c.moveTo(fresh, fresh.Energy())
+		} else {
+			c.moveTo(c.best.State, c.best.Energy)
+		}
+		c.restartSchedule(c.initialTemperature)
+		c.stale = 0
+		c.best.Stats.Restarts++
+	case c.conf.Reheat != nil && c.conf.Reheat.Patience > 0 && c.stale > 0 && c.stale%c.conf.Reheat.Patience == 0:
+		ratio := c.conf.Reheat.Ratio
+		if ratio == 0 {
+			ratio = 0.5
+		}
+		c.restartSchedule(ratio * c.initialTemperature)
+		c.best.Stats.Reheats++
+	default:
 		// Anneal the temperature (cooling down)
-		temperature = temperature * conf.AneallingFactor
+		c.progress.Iteration = c.best.Stats.Iterations - c.scheduleStart
+		c.temperature = c.schedule.Next(c.temperature, c.progress)
+	}
+}
+
+// Cooling returns the initial temperature and the cooling schedule of a run configured by conf starting from s.
+// The temperature is calibrated with r when conf.Temperature is 0.
+func Cooling(s State, r *rand.Rand, conf Config) (float64, CoolingSchedule) {
+	temperature := conf.Temperature
+	if temperature == 0 {
+		acceptance := conf.InitialAcceptance
+		if acceptance == 0 {
+			acceptance = 0.8
+		}
+		temperature = Calibrate(s, r, calibrationSamples, acceptance)
+	}
+
+	schedule := conf.Schedule
+	if schedule == nil {
+		factor := conf.AneallingFactor
+		if conf.FinalTemperature > 0 && conf.Iteration > 0 {
+			factor = math.Pow(conf.FinalTemperature/temperature, 1/float64(conf.Iteration))
+		}
+		schedule = Exponential{Factor: factor}
 	}
+	return temperature, schedule
+}
+
+// Accept tells whether to move from a state of energy current to one of energy next at the given temperature.
+// Better states are always accepted, worse ones with the probability exp((current - next) / temperature).
+func Accept(current, next, temperature float64, r *rand.Rand) bool {
+	return next < current || math.Exp((current-next)/temperature) > r.Float64()
+}
 
-	return currState
+// Calibrate estimates the temperature at which the given share of worse neighbors is accepted.
+// It takes a random walk of n steps from s and averages the energy increase of the uphill steps, the acceptance
+// probability exp(-delta/T) of that average is then solved for T.
+func Calibrate(s State, r *rand.Rand, n int, acceptance float64) float64 {
+	var sum float64
+	var uphill int
+
+	currEnergy := s.Energy()
+	for i := 0; i < n; i++ {
+		neighbor := s.Neighbor(r)
+		neighborEnergy := neighbor.Energy()
+		if neighborEnergy > currEnergy {
+			sum += neighborEnergy - currEnergy
+			uphill++
+		}
+		s, currEnergy = neighbor, neighborEnergy
+	}
+
+	// Every step went downhill or sideways, any temperature will do
+	if uphill == 0 {
+		return 1
+	}
+	return -(sum / float64(uphill)) / math.Log(acceptance)
 }
@@ -0,0 +1,169 @@
+package anneal
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Walk on the integer line, with the minimum energy at 37
+type point struct {
+	x       int
+	visited *[]float64
+}
+
+func (p point) Energy() float64 {
+	return float64((p.x - 37) * (p.x - 37))
+}
+
+func (p point) Neighbor(r *rand.Rand) State {
+	n := point{x: p.x + r.Intn(3) - 1, visited: p.visited}
+	*p.visited = append(*p.visited, n.Energy())
+	return n
+}
+
+func (p point) PrintMovement() {}
+
+func TestInitReturnsBest(t *testing.T) {
+	visited := make([]float64, 0)
+	initial := point{x: 0, visited: &visited}
+
+	res := Init(context.Background(), initial, Config{Iteration: 2000, Temperature: 1000, AneallingFactor: 0.999, Seed: 1})
+
+	// The best energy is the lowest of every accepted neighbor, which is never above the lowest of all visited
+	lowest := initial.Energy()
+	for _, e := range visited {
+		if e < lowest {
+			lowest = e
+		}
+	}
+	assert.LessOrEqual(t, lowest, res.Energy)
+	assert.LessOrEqual(t, res.Energy, initial.Energy())
+	assert.Equal(t, res.State.Energy(), res.Energy)
+	assert.Equal(t, uint(2000), res.Stats.Iterations)
+	assert.Equal(t, res.Stats.Iterations, res.Stats.Accepted+res.Stats.Rejected)
+	assert.LessOrEqual(t, res.Stats.BestIteration, res.Stats.Iterations)
+}
+
+func TestInitStopsEarly(t *testing.T) {
+	visited := make([]float64, 0)
+	initial := point{x: 0, visited: &visited}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := Init(ctx, initial, Config{Iteration: 1000, Temperature: 1000, AneallingFactor: 0.99})
+	assert.True(t, res.Stopped)
+	assert.Equal(t, uint(0), res.Stats.Iterations)
+	assert.Equal(t, initial, res.State)
+
+	res = Init(context.Background(), initial, Config{Iteration: math.MaxInt32, Temperature: 1000, AneallingFactor: 0.99, TimeBudget: 10 * time.Millisecond})
+	assert.True(t, res.Stopped)
+	assert.Less(t, res.Stats.Iterations, uint(math.MaxInt32))
+	assert.LessOrEqual(t, res.Energy, initial.Energy())
+}
+
+func TestCoolingSchedules(t *testing.T) {
+	p := Progress{Iteration: 50, Iterations: 100, Initial: 100}
+	assert.Equal(t, 90.0, Exponential{Factor: 0.9}.Next(100, p))
+	assert.Equal(t, 55.0, Linear{Final: 10}.Next(100, p))
+	assert.InDelta(t, 100/(1+math.Log(51)), Logarithmic{}.Next(100, p), 1e-9)
+	assert.InDelta(t, 100/(1+0.01*100), LundyMees{Beta: 0.01}.Next(100, p), 1e-9)
+
+	// Adaptive heats up when too few neighbors are accepted and cools down when too many are
+	p.AcceptanceRate = 0
+	assert.Greater(t, Adaptive{}.Next(100, p), 100.0)
+	p.AcceptanceRate = 1
+	assert.Less(t, Adaptive{}.Next(100, p), 100.0)
+
+	schedules := []CoolingSchedule{Exponential{Factor: 0.99}, Linear{}, Logarithmic{}, LundyMees{Beta: 0.001}, Adaptive{}}
+	for _, schedule := range schedules {
+		visited := make([]float64, 0)
+		res := Init(context.Background(), point{visited: &visited}, Config{Iteration: 5000, Temperature: 100, Schedule: schedule, Seed: 1})
+		assert.Equal(t, 0.0, res.Energy, "%T", schedule)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	visited := make([]float64, 0)
+	r := rand.New(rand.NewSource(1))
+
+	// A higher initial acceptance needs a higher temperature
+	low := Calibrate(point{x: 100, visited: &visited}, r, 200, 0.2)
+	high := Calibrate(point{x: 100, visited: &visited}, r, 200, 0.9)
+	assert.Greater(t, low, 0.0)
+	assert.Greater(t, high, low)
+
+	// The cooling factor is derived from the final temperature
+	res := Init(context.Background(), point{x: 100, visited: &visited}, Config{Iteration: 5000, FinalTemperature: 0.01, Seed: 1})
+	assert.Equal(t, 0.0, res.Energy)
+}
+
+// Walk on [0, 100] with a local minimum at 10 and the global minimum at 60, separated by a high barrier
+type trap int
+
+func (x trap) Energy() float64 {
+	if x < 35 {
+		return math.Abs(float64(x-10)) + 5
+	}
+	return math.Abs(float64(x - 60))
+}
+
+func (x trap) Neighbor(r *rand.Rand) State {
+	n := x + trap(r.Intn(3)-1)
+	if n < 0 || n > 100 {
+		return x
+	}
+	return n
+}
+
+func (x trap) PrintMovement() {}
+
+func TestRestartAndReheat(t *testing.T) {
+	conf := Config{Iteration: 5000, Temperature: 0.01, AneallingFactor: 1, Seed: 1}
+
+	res := Init(context.Background(), trap(0), conf)
+	assert.Equal(t, 5.0, res.Energy)
+
+	conf.Reheat = &Reheat{Patience: 100}
+	res = Init(context.Background(), trap(0), conf)
+	assert.Greater(t, res.Stats.Reheats, uint(0))
+
+	conf.Restart = &Restart{Patience: 500, From: RestartFresh, Fresh: func(r *rand.Rand) State { return trap(r.Intn(101)) }}
+	res = Init(context.Background(), trap(0), conf)
+	assert.Equal(t, 0.0, res.Energy)
+	assert.Greater(t, res.Stats.Restarts, uint(0))
+}
+
+func TestParallel(t *testing.T) {
+	conf := Config{Iteration: 2000, Temperature: 0.01, AneallingFactor: 1, Seed: 1}
+	fresh := func(r *rand.Rand) State { return trap(r.Intn(101)) }
+
+	res := Parallel(context.Background(), trap(0), conf, ParallelConfig{Chains: 8, Workers: 3, Fresh: fresh})
+	assert.Equal(t, 0.0, res.Energy)
+	assert.Equal(t, uint(8*2000), res.Stats.Iterations)
+	assert.False(t, res.Stopped)
+
+	// The result does not depend on the scheduling of the goroutines
+	again := Parallel(context.Background(), trap(0), conf, ParallelConfig{Chains: 8, Workers: 8, Fresh: fresh})
+	assert.Equal(t, res, again)
+
+	// Sharing pulls every chain to the best state
+	res = Parallel(context.Background(), trap(0), conf, ParallelConfig{Chains: 4, ShareEvery: 100, Fresh: fresh})
+	assert.Equal(t, 0.0, res.Energy)
+}
+
+func TestTempering(t *testing.T) {
+	ladder := GeometricLadder(0.01, 100, 6)
+	assert.InDelta(t, 0.01, ladder[0], 1e-12)
+	assert.InDelta(t, 100, ladder[5], 1e-9)
+
+	// The hot replicas cross the barrier and hand their states down to the cold ones
+	res := Tempering(context.Background(), trap(0), TemperingConfig{Temperatures: ladder, Iteration: 5000, SwapEvery: 50, Seed: 1})
+	assert.Equal(t, 0.0, res.Energy)
+	assert.Greater(t, res.Stats.Swaps, uint(0))
+	assert.Equal(t, uint(6*5000), res.Stats.Iterations)
+}
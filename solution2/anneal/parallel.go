@@ -0,0 +1,130 @@
+package anneal
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Cloner is implemented by states holding data which must not be shared between goroutines.
+// Parallel gives every chain its own copy of such states.
+type Cloner interface {
+	Clone() State
+}
+
+// ParallelConfig controls how Parallel runs its chains
+type ParallelConfig struct {
+	// Number of independent chains, defaults to the number of CPUs
+	Chains int
+	// Number of chains running at the same time, defaults to the number of CPUs
+	Workers int
+	// Every ShareEvery iterations the chains which are worse than the best state found by any chain continue
+	// from a copy of it, 0 to let the chains run independently
+	ShareEvery uint
+	// Creates the initial state of every chain, all chains start from the given state when nil
+	Fresh func(r *rand.Rand) State
+}
+
+// Parallel runs several annealing chains at once and returns the best state found by any of them.
+// Every chain gets its own seed derived from conf.Seed and runs conf.Iteration iterations, so the result only
+// depends on the configuration and not on how the goroutines are scheduled.
+// The Stats of the result are summed over the chains, except BestIteration which is the one of the best chain.
+func Parallel(ctx context.Context, initial State, conf Config, pc ParallelConfig) Result {
+	if conf.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.TimeBudget)
+		defer cancel()
+	}
+	if pc.Chains <= 0 {
+		pc.Chains = runtime.NumCPU()
+	}
+	if pc.Workers <= 0 {
+		pc.Workers = runtime.NumCPU()
+	}
+	segment := pc.ShareEvery
+	if segment == 0 {
+		segment = conf.Iteration
+	}
+
+	seeds := rand.New(rand.NewSource(conf.Seed))
+	chains := make([]*chain, pc.Chains)
+	for i := range chains {
+		chainConf := conf
+		chainConf.Seed = seeds.Int63()
+		s := clone(initial)
+		if pc.Fresh != nil {
+			s = pc.Fresh(seeds)
+		}
+		chains[i] = newChain(s, chainConf)
+	}
+
+	done := uint(0)
+	for ; done < conf.Iteration && ctx.Err() == nil; done += segment {
+		runSegment(ctx, chains, pc.Workers, segment)
+
+		// Share the best state
+		if pc.ShareEvery > 0 {
+			best := bestChain(chains)
+			for _, c := range chains {
+				if c.currEnergy > best.best.Energy {
+					c.moveTo(clone(best.best.State), best.best.Energy)
+				}
+			}
+		}
+	}
+
+	res := merge(chains)
+	res.Stopped = res.Stopped || done < conf.Iteration
+	return res
+}
+
+// Run n iterations of every chain, at most workers at a time
+func runSegment(ctx context.Context, chains []*chain, workers int, n uint) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+	for _, c := range chains {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(c *chain) {
+			defer wg.Done()
+			c.run(ctx, n)
+			<-slots
+		}(c)
+	}
+	wg.Wait()
+}
+
+// Result of the best chain, with the stats summed over all chains except BestIteration
+func merge(chains []*chain) Result {
+	res := bestChain(chains).best
+	res.Stats = Stats{BestIteration: res.Stats.BestIteration}
+	for _, c := range chains {
+		res.Stats.Iterations += c.best.Stats.Iterations
+		res.Stats.Accepted += c.best.Stats.Accepted
+		res.Stats.Rejected += c.best.Stats.Rejected
+		res.Stats.Reheats += c.best.Stats.Reheats
+		res.Stats.Restarts += c.best.Stats.Restarts
+		res.Stopped = res.Stopped || c.best.Stopped
+	}
+	return res
+}
+
+// Chain with the lowest best energy, the first one on ties
+func bestChain(chains []*chain) *chain {
+	best := chains[0]
+	for _, c := range chains[1:] {
+		if c.best.Energy < best.best.Energy {
+			best = c
+		}
+	}
+	return best
+}
+
+// Copy of s if it has to be copied to be used by another goroutine
+func clone(s State) State {
+	if c, ok := s.(Cloner); ok {
+		return c.Clone()
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package anneal
+
+import "math"
+
+// CoolingSchedule decides how the temperature changes from one iteration to the next
+type CoolingSchedule interface {
+	// Next returns the temperature of the next iteration
+	Next(temperature float64, p Progress) float64
+}
+
+// Progress of the run, given to the cooling schedule after every iteration
+type Progress struct {
+	// Number of iterations done and the iteration budget, counted from the start of the run or the last reheat
+	Iteration  uint
+	Iterations uint
+	// Temperature the run started or was last reheated with
+	Initial float64
+	// Moving average of the share of accepted neighbors
+	AcceptanceRate float64
+}
+
+// Weight of the latest iteration in the moving average of the acceptance rate, roughly a window of 100 iterations
+const acceptanceRateSmoothing = 0.01
+
+// Record adds whether the latest neighbor was accepted to the moving average of the acceptance rate
+func (p *Progress) Record(accepted bool) {
+	if accepted {
+		p.AcceptanceRate += acceptanceRateSmoothing * (1 - p.AcceptanceRate)
+	} else {
+		p.AcceptanceRate -= acceptanceRateSmoothing * p.AcceptanceRate
+	}
+}
+
+// Share of the run done so far, between 0 and 1
+func (p Progress) done() float64 {
+	if p.Iterations == 0 {
+		return 1
+	}
+	return math.Min(1, float64(p.Iteration)/float64(p.Iterations))
+}
+
+// Exponential (geometric) cooling, the temperature is multiplied by Factor every iteration
+type Exponential struct {
+	Factor float64
+}
+
+func (s Exponential) Next(temperature float64, p Progress) float64 {
+	return temperature * s.Factor
+}
+
+// Linear cooling from the initial temperature down to Final at the end of the run
+type Linear struct {
+	Final float64
+}
+
+func (s Linear) Next(temperature float64, p Progress) float64 {
+	return p.Initial - (p.Initial-s.Final)*p.done()
+}
+
+// Logarithmic cooling, T = T0 / (1 + C * ln(1 + k)). C defaults to 1.
+// It cools very slowly, which suits short runs or rugged energy landscapes.
+type Logarithmic struct {
+	C float64
+}
+
+func (s Logarithmic) Next(temperature float64, p Progress) float64 {
+	c := s.C
+	if c == 0 {
+		c = 1
+	}
+	return p.Initial / (1 + c*math.Log(1+float64(p.Iteration)))
+}
+
+// Lundy-Mees cooling, T = T / (1 + Beta * T)
+type LundyMees struct {
+	Beta float64
+}
+
+func (s LundyMees) Next(temperature float64, p Progress) float64 {
+	return temperature / (1 + s.Beta*temperature)
+}
+
+// Adaptive cooling steers the temperature so that the acceptance rate follows a target.
+// The target goes down geometrically from InitialRate to FinalRate over the run, the temperature is raised when
+// fewer neighbors than targeted are accepted and lowered when more are. Gain sets how fast it reacts.
+// Zero values default to 0.5, 0.001 and 0.01.
+type Adaptive struct {
+	InitialRate float64
+	FinalRate   float64
+	Gain        float64
+}
+
+func (s Adaptive) Next(temperature float64, p Progress) float64 {
+	initialRate, finalRate, gain := s.InitialRate, s.FinalRate, s.Gain
+	if initialRate == 0 {
+		initialRate = 0.5
+	}
+	if finalRate == 0 {
+		finalRate = 0.001
+	}
+	if gain == 0 {
+		gain = 0.01
+	}
+
+	target := initialRate * math.Pow(finalRate/initialRate, p.done())
+	return temperature * math.Exp(gain*(target-p.AcceptanceRate)/math.Max(target, p.AcceptanceRate))
+}
@@ -0,0 +1,89 @@
+package anneal
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"time"
+)
+
+// TemperingConfig controls a parallel tempering (replica exchange) run
+type TemperingConfig struct {
+	// Fixed temperature of every replica, from the coldest to the hottest
+	Temperatures []float64
+	// Number of iterations of every replica
+	Iteration uint
+	// Neighbouring replicas try to swap their states every SwapEvery iterations, defaults to 100
+	SwapEvery uint
+	// Number of replicas running at the same time, defaults to the number of CPUs
+	Workers int
+	Seed    int64
+	// Wall clock budget of the run, 0 for no limit
+	TimeBudget time.Duration
+}
+
+// GeometricLadder spreads n temperatures geometrically between min and max, a common choice for parallel tempering
+func GeometricLadder(min, max float64, n int) []float64 {
+	if n == 1 {
+		return []float64{min}
+	}
+	ladder := make([]float64, n)
+	for i := range ladder {
+		ladder[i] = min * math.Pow(max/min, float64(i)/float64(n-1))
+	}
+	return ladder
+}
+
+// Tempering runs one replica of initial per temperature, each annealing at its fixed temperature. Periodically
+// neighbouring replicas swap their states following the Metropolis criterion, so that good states found by the hot
+// replicas sink down to the cold ones while the hot replicas keep exploring.
+// The best state seen by any replica is returned, with the stats summed over the replicas.
+func Tempering(ctx context.Context, initial State, conf TemperingConfig) Result {
+	if conf.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.TimeBudget)
+		defer cancel()
+	}
+	if conf.SwapEvery == 0 {
+		conf.SwapEvery = 100
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = runtime.NumCPU()
+	}
+
+	if len(conf.Temperatures) == 0 {
+		return Result{State: initial, Energy: initial.Energy()}
+	}
+
+	r := rand.New(rand.NewSource(conf.Seed))
+	replicas := make([]*chain, len(conf.Temperatures))
+	for i, t := range conf.Temperatures {
+		// The temperature of a replica never changes
+		replicas[i] = newChain(clone(initial), Config{Iteration: conf.Iteration, Temperature: t, Schedule: Exponential{Factor: 1}, Seed: r.Int63()})
+	}
+
+	var swaps uint
+	done := uint(0)
+	for round := 0; done < conf.Iteration && ctx.Err() == nil; round++ {
+		runSegment(ctx, replicas, conf.Workers, conf.SwapEvery)
+		done += conf.SwapEvery
+
+		// Alternate between the even and the odd pairs of neighbouring replicas
+		for i := round % 2; i+1 < len(replicas); i += 2 {
+			cold, hot := replicas[i], replicas[i+1]
+			delta := (cold.currEnergy - hot.currEnergy) * (1/cold.temperature - 1/hot.temperature)
+			if delta >= 0 || math.Exp(delta) > r.Float64() {
+				coldState, coldEnergy := cold.currState, cold.currEnergy
+				cold.moveTo(hot.currState, hot.currEnergy)
+				hot.moveTo(coldState, coldEnergy)
+				swaps++
+			}
+		}
+	}
+
+	res := merge(replicas)
+	res.Stats.Swaps = swaps
+	res.Stopped = res.Stopped || done < conf.Iteration
+	return res
+}
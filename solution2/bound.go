@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"solution2/graph"
+	"solution2/types"
+)
+
+// lowerBound returns a value no plan can go below, under any of the objectives.
+// Every package has to be carried by a train able to carry it, which first travels from its start to the package
+// station and then on to the destination. The fastest train to do so for the slowest package sets the bound on the
+// time of a single train, which bounds the makespan and the total time alike.
+func lowerBound(problem types.Problem, paths *graph.Graph) float64 {
+	bound := 0
+	for _, p := range problem.Package {
+		fastest := math.MaxInt
+		for _, t := range problem.Train {
+			if t.Capacity < p.Weight {
+				continue
+			}
+			if time := paths.Distance(t.StartAt, p.StartAt) + paths.Distance(p.StartAt, p.Destination); time < fastest {
+				fastest = time
+			}
+		}
+		if fastest != math.MaxInt && fastest > bound {
+			bound = fastest
+		}
+	}
+	return float64(bound)
+}
+
+// Share by which the energy is above the lower bound, the plan is at most this much slower than the optimal plan.
+// It is infinite when the bound is 0 and the energy is not.
+func gap(energy, bound float64) float64 {
+	if energy <= bound {
+		return 0
+	}
+	return (energy - bound) / bound
+}
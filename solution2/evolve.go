@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math/rand"
+	"solution2/genetic"
+)
+
+// Crossover keeps a random slice of every train's package sequence of s and appends the other packages to the train
+// carrying them in the other parent, in the order they have there (order crossover). Every package keeps whether its
+// delivery is deferred from the parent it comes from. Overloaded trains are repaired, and a child which cannot be
+// repaired is rejected in favour of s.
+func (s State) Crossover(other genetic.Individual, r *rand.Rand) genetic.Individual {
+	o := other.(State)
+	child := s.clone()
+	child.TrainAssignment = make(map[string][]string, len(s.Train))
+	child.Deferred = make(map[string]bool)
+
+	kept := make(map[string]bool)
+	for _, t := range sortedKeys(s.Train) {
+		sequence := s.TrainAssignment[t]
+		child.TrainAssignment[t] = []string{}
+		if len(sequence) == 0 {
+			continue
+		}
+		i := r.Intn(len(sequence))
+		j := i + r.Intn(len(sequence)-i+1)
+		for _, p := range sequence[i:j] {
+			child.TrainAssignment[t] = append(child.TrainAssignment[t], p)
+			child.Deferred[p] = s.Deferred[p]
+			kept[p] = true
+		}
+	}
+	for _, t := range sortedKeys(o.Train) {
+		for _, p := range o.TrainAssignment[t] {
+			if !kept[p] {
+				child.TrainAssignment[t] = append(child.TrainAssignment[t], p)
+				child.Deferred[p] = o.Deferred[p]
+			}
+		}
+	}
+
+	if !child.repair(r) {
+		return s
+	}
+	route, move, err := planRoute(child.Router, child.TrainAssignment, child.Deferred, child.Train, r)
+	if err != nil {
+		return s
+	}
+	child.Route, child.Move = route, move
+	return child
+}
+
+// Mutate moves a random package to a random position of a random train able to reach it, and defers its delivery or
+// delivers it right away again half of the time. Then it repairs overloaded trains, when they cannot be repaired s is
+// returned unchanged.
+func (s State) Mutate(r *rand.Rand) genetic.Individual {
+	child := s.clone()
+	pkgs := sortedKeys(s.Package)
+	if len(pkgs) == 0 {
+		return child
+	}
+	p := pkgs[r.Intn(len(pkgs))]
+
+	for t, sequence := range child.TrainAssignment {
+		for i, each := range sequence {
+			if each == p {
+				child.TrainAssignment[t] = append(sequence[:i], sequence[i+1:]...)
+				break
+			}
+		}
+	}
+	trains := make([]string, 0, len(s.Train))
+	for _, t := range sortedKeys(s.Train) {
+		if s.Router.reaches(s.Train[t], s.Package[p]) {
+			trains = append(trains, t)
+		}
+	}
+	t := trains[r.Intn(len(trains))]
+	sequence := child.TrainAssignment[t]
+	i := r.Intn(len(sequence) + 1)
+	child.TrainAssignment[t] = append(sequence[:i], append([]string{p}, sequence[i:]...)...)
+	if r.Intn(2) == 0 {
+		child.Deferred = toggled(s.Deferred, p)
+	}
+
+	if !child.repair(r) {
+		return s
+	}
+	route, move, err := planRoute(child.Router, child.TrainAssignment, child.Deferred, child.Train, r)
+	if err != nil {
+		return s
+	}
+	child.Route, child.Move = route, move
+	return child
+}
+
+// Move packages off overloaded trains onto trains with enough capacity left which reach them.
+// Returns false when a train stays overloaded because none of its packages fits anywhere else.
+func (s State) repair(r *rand.Rand) bool {
+	trains := sortedKeys(s.Train)
+	for _, t := range trains {
+		for s.load(t) > s.Train[t].Capacity {
+			moved := false
+			for _, i := range r.Perm(len(s.TrainAssignment[t])) {
+				p := s.TrainAssignment[t][i]
+				candidate := make([]string, 0, len(trains))
+				for _, k := range trains {
+					if k != t && s.load(k)+s.Package[p].Weight <= s.Train[k].Capacity && s.Router.reaches(s.Train[k], s.Package[p]) {
+						candidate = append(candidate, k)
+					}
+				}
+				if len(candidate) == 0 {
+					continue
+				}
+
+				k := candidate[r.Intn(len(candidate))]
+				s.TrainAssignment[t] = append(s.TrainAssignment[t][:i], s.TrainAssignment[t][i+1:]...)
+				s.TrainAssignment[k] = append(s.TrainAssignment[k], p)
+				moved = true
+				break
+			}
+			if !moved {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"solution2/graph"
+	"solution2/types"
+	"sort"
+)
+
+// Largest number of packages solveExact accepts, the search grows exponentially with it
+const exactMaxPackages = 12
+
+// Pickup or drop off of a package by a train
+type event struct {
+	pkg  string
+	drop bool
+}
+
+// Fastest way for a train to deliver a set of packages
+type trainPlan struct {
+	time   int
+	events []event
+}
+
+// exactSolver finds the fastest delivery order of every set of packages for every train, and remembers them
+type exactSolver struct {
+	problem types.Problem
+	paths   *graph.Graph
+	// Packages in a fixed order, a set of packages is a bit mask over it
+	pkgs  []string
+	plans map[string]map[uint]trainPlan
+}
+
+// solveExact returns a plan with the lowest energy under the objective, proven by searching every assignment of
+// packages to trains. A train can carry all its packages at once, as long as their weight does not exceed its
+// capacity, and picks them up and drops them off in the fastest possible order along the shortest paths.
+// It returns an error for instances with more than exactMaxPackages packages or without any assignment within the
+// capacity of the trains.
+func solveExact(problem types.Problem, objective Objective) (State, error) {
+	if len(problem.Package) > exactMaxPackages {
+		return State{}, fmt.Errorf("%d packages are too many to solve exactly, the limit is %d", len(problem.Package), exactMaxPackages)
+	}
+
+	e := exactSolver{problem: problem, paths: graph.ForNetwork(problem.Graph, problem.Network), plans: make(map[string]map[uint]trainPlan)}
+	// Heavier packages first, they have the fewest trains to go on which prunes the search early
+	e.pkgs = sortedKeys(problem.Package)
+	sort.SliceStable(e.pkgs, func(i, j int) bool {
+		return problem.Package[e.pkgs[i]].Weight > problem.Package[e.pkgs[j]].Weight
+	})
+	trains := sortedKeys(problem.Train)
+	for _, t := range trains {
+		e.plans[t] = make(map[uint]trainPlan)
+	}
+
+	bestEnergy := math.Inf(1)
+	var bestMasks map[string]uint
+	masks := make(map[string]uint, len(trains))
+	load := make(map[string]int, len(trains))
+
+	// Branch on the train of the i-th package, bounded by the energy of the packages assigned so far, which
+	// never goes down as more packages are added
+	var branch func(i int)
+	branch = func(i int) {
+		timeTaken := make(map[string]int, len(trains))
+		for _, t := range trains {
+			timeTaken[t] = e.plan(t, masks[t]).time
+		}
+		energy := objective.Evaluate(timeTaken)
+		if energy >= bestEnergy {
+			return
+		}
+		if i == len(e.pkgs) {
+			bestEnergy = energy
+			bestMasks = make(map[string]uint, len(trains))
+			for t, m := range masks {
+				bestMasks[t] = m
+			}
+			return
+		}
+
+		p := problem.Package[e.pkgs[i]]
+		for _, t := range trains {
+			if load[t]+p.Weight > problem.Train[t].Capacity {
+				continue
+			}
+			masks[t] |= 1 << i
+			load[t] += p.Weight
+			branch(i + 1)
+			masks[t] &^= 1 << i
+			load[t] -= p.Weight
+		}
+	}
+	branch(0)
+
+	if bestMasks == nil {
+		return State{}, fmt.Errorf("the packages do not fit on the trains")
+	}
+	events := make(map[string][]event, len(trains))
+	for t, mask := range bestMasks {
+		events[t] = e.plan(t, mask).events
+	}
+	return eventState(problem, e.paths, events, objective), nil
+}
+
+// Fastest plan for the train to deliver the set of packages
+func (e exactSolver) plan(train string, mask uint) trainPlan {
+	if p, ok := e.plans[train][mask]; ok {
+		return p
+	}
+
+	// Time to finish from a station with the picked up and dropped off packages, and the next event to get there
+	type key struct {
+		location        string
+		picked, dropped uint
+	}
+	type step struct {
+		time int
+		next event
+		bit  uint
+	}
+	memo := make(map[key]step)
+	var finish func(k key) step
+	finish = func(k key) step {
+		if k.dropped == mask {
+			return step{}
+		}
+		if s, ok := memo[k]; ok {
+			return s
+		}
+
+		best := step{time: math.MaxInt}
+		for i, name := range e.pkgs {
+			bit := uint(1) << i
+			pkg := e.problem.Package[name]
+			var ev event
+			var next key
+			switch {
+			case mask&bit == 0 || k.dropped&bit != 0:
+				continue
+			case k.picked&bit == 0:
+				ev, next = event{pkg: name}, key{location: pkg.StartAt, picked: k.picked | bit, dropped: k.dropped}
+			default:
+				ev, next = event{pkg: name, drop: true}, key{location: pkg.Destination, picked: k.picked, dropped: k.dropped | bit}
+			}
+			if time := e.paths.Distance(k.location, next.location) + finish(next).time; time < best.time {
+				best = step{time: time, next: ev, bit: bit}
+			}
+		}
+		memo[k] = best
+		return best
+	}
+
+	// Follow the best events from the start
+	k := key{location: e.problem.Train[train].StartAt}
+	p := trainPlan{time: finish(k).time, events: make([]event, 0, 2*bits.OnesCount(mask))}
+	for k.dropped != mask {
+		s := finish(k)
+		p.events = append(p.events, s.next)
+		if s.next.drop {
+			k = key{location: e.problem.Package[s.next.pkg].Destination, picked: k.picked, dropped: k.dropped | s.bit}
+		} else {
+			k = key{location: e.problem.Package[s.next.pkg].StartAt, picked: k.picked | s.bit, dropped: k.dropped}
+		}
+	}
+	e.plans[train][mask] = p
+	return p
+}
+
+// State in which every train picks up and drops off packages in the order of its events, along the shortest paths
+func eventState(problem types.Problem, paths *graph.Graph, events map[string][]event, objective Objective) State {
+	s := State{
+		TrainAssignment: make(map[string][]string),
+		Route:           make(map[string][]string),
+		Move:            make([]Move, 0),
+		Router:          Router{Network: problem.Network, Paths: paths, Packages: newPackageIndex(problem)},
+		Train:           problem.Train,
+		Package:         problem.Package,
+		Objective:       objective,
+	}
+
+	for _, t := range sortedKeys(problem.Train) {
+		s.TrainAssignment[t] = []string{}
+		location := problem.Train[t].StartAt
+		timeTaken := 0
+		route := []string{location}
+		// Packages picked up at the current station, they are loaded when the train departs
+		loaded := make([]string, 0)
+		// Index of the latest move of the train, packages dropped off at a station belong to the move arriving there
+		last := -1
+
+		for _, ev := range events[t] {
+			target := problem.Package[ev.pkg].StartAt
+			if ev.drop {
+				target = problem.Package[ev.pkg].Destination
+			}
+			if target != location {
+				path := paths.Path(location, target)
+				for i := 0; i < len(path)-1; i++ {
+					m := Move{
+						Start:          timeTaken,
+						End:            timeTaken + problem.Graph[path[i]][path[i+1]],
+						Train:          t,
+						StartNode:      path[i],
+						EndNode:        path[i+1],
+						PickedPackage:  loaded,
+						DroppedPackage: []string{},
+					}
+					loaded = make([]string, 0)
+					timeTaken = m.End
+					s.Move = append(s.Move, m)
+					last = len(s.Move) - 1
+				}
+				route = append(route, path[1:]...)
+				location = target
+			}
+
+			if !ev.drop {
+				s.TrainAssignment[t] = append(s.TrainAssignment[t], ev.pkg)
+				loaded = append(loaded, ev.pkg)
+			} else if last >= 0 {
+				s.Move[last].DroppedPackage = append(s.Move[last].DroppedPackage, ev.pkg)
+			}
+		}
+		s.Route[t] = route
+	}
+
+	sortMoves(s.Move)
+	return s
+}
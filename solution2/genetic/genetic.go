@@ -0,0 +1,170 @@
+package genetic
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"solution2/anneal"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Individual is a candidate solution, its Energy is the value to minimise
+type Individual interface {
+	anneal.State
+	// Crossover combines the individual with another parent into a new child
+	Crossover(other Individual, r *rand.Rand) Individual
+	// Mutate returns a slightly changed copy of the individual
+	Mutate(r *rand.Rand) Individual
+}
+
+type Config struct {
+	// Number of individuals in every generation, defaults to 50
+	Population  int
+	Generations uint
+	// Number of individuals competing in a tournament selection, defaults to 3
+	TournamentSize int
+	// Number of best individuals copied unchanged into the next generation, defaults to 2, negative to copy none
+	Elite int
+	// Probability of a child to be made by crossover rather than copied from its first parent, defaults to 0.9
+	CrossoverRate float64
+	// Probability of a child to be mutated, defaults to 0.2
+	MutationRate float64
+	// Number of children made and evaluated at the same time, defaults to the number of CPUs
+	Workers int
+	Seed    int64
+	// Wall clock budget of the run, 0 for no limit
+	TimeBudget time.Duration
+}
+
+type member struct {
+	individual Individual
+	energy     float64
+}
+
+// Evolve runs a genetic algorithm on a population created by fresh, and returns the best individual found.
+// Every child gets its own random number generator seeded from conf.Seed, so children are made and evaluated in
+// parallel while the result only depends on the configuration.
+// Stats.Iterations counts the generations and Stats.BestIteration is the generation the best individual was found in.
+func Evolve(ctx context.Context, fresh func(r *rand.Rand) Individual, conf Config) anneal.Result {
+	if conf.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.TimeBudget)
+		defer cancel()
+	}
+	conf = conf.withDefaults()
+
+	r := rand.New(rand.NewSource(conf.Seed))
+	population := breed(conf, r, func(cr *rand.Rand) Individual {
+		return fresh(cr)
+	})
+	best := anneal.Result{State: population[0].individual, Energy: population[0].energy}
+
+	for generation := uint(1); generation <= conf.Generations; generation++ {
+		if ctx.Err() != nil {
+			best.Stopped = true
+			break
+		}
+
+		population = nextGeneration(conf, population, r)
+
+		best.Stats.Iterations = generation
+		if population[0].energy < best.Energy {
+			best.State = population[0].individual
+			best.Energy = population[0].energy
+			best.Stats.BestIteration = generation
+		}
+	}
+	return best
+}
+
+func (conf Config) withDefaults() Config {
+	if conf.Population <= 0 {
+		conf.Population = 50
+	}
+	if conf.TournamentSize <= 0 {
+		conf.TournamentSize = 3
+	}
+	switch {
+	case conf.Elite == 0:
+		conf.Elite = 2
+	case conf.Elite < 0:
+		conf.Elite = 0
+	}
+	if conf.Elite > conf.Population {
+		conf.Elite = conf.Population
+	}
+	if conf.CrossoverRate == 0 {
+		conf.CrossoverRate = 0.9
+	}
+	if conf.MutationRate == 0 {
+		conf.MutationRate = 0.2
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = runtime.NumCPU()
+	}
+	return conf
+}
+
+// Children of the population, sorted from best to worst
+func nextGeneration(conf Config, population []member, r *rand.Rand) []member {
+	next := breed(conf, r, func(cr *rand.Rand) Individual {
+		child := tournament(population, conf.TournamentSize, cr)
+		if cr.Float64() < conf.CrossoverRate {
+			child = child.Crossover(tournament(population, conf.TournamentSize, cr), cr)
+		}
+		if cr.Float64() < conf.MutationRate {
+			child = child.Mutate(cr)
+		}
+		return child
+	})
+	// Elitism, the best individuals replace the worst children
+	copy(next[len(next)-conf.Elite:], population[:conf.Elite])
+	sortPopulation(next)
+	return next
+}
+
+// Make a population of conf.Population individuals in parallel, sorted from best to worst
+func breed(conf Config, r *rand.Rand, produce func(r *rand.Rand) Individual) []member {
+	population := make([]member, conf.Population)
+	seeds := make([]int64, conf.Population)
+	for i := range seeds {
+		seeds[i] = r.Int63()
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, conf.Workers)
+	for i := range population {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			individual := produce(rand.New(rand.NewSource(seeds[i])))
+			population[i] = member{individual: individual, energy: individual.Energy()}
+			<-slots
+		}(i)
+	}
+	wg.Wait()
+
+	sortPopulation(population)
+	return population
+}
+
+// Best of size randomly picked individuals
+func tournament(population []member, size int, r *rand.Rand) Individual {
+	best := population[r.Intn(len(population))]
+	for i := 1; i < size; i++ {
+		m := population[r.Intn(len(population))]
+		if m.energy < best.energy {
+			best = m
+		}
+	}
+	return best.individual
+}
+
+func sortPopulation(population []member) {
+	sort.SliceStable(population, func(i, j int) bool {
+		return population[i].energy < population[j].energy
+	})
+}
@@ -0,0 +1,52 @@
+package genetic
+
+import (
+	"math"
+	"math/rand"
+	"solution2/anneal"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Point whose energy is its distance from the origin, children land anywhere around their parents
+type point struct {
+	x, y float64
+}
+
+func (p point) Energy() float64 {
+	return math.Hypot(p.x, p.y)
+}
+
+func (p point) Neighbor(r *rand.Rand) anneal.State {
+	return p.Mutate(r).(point)
+}
+
+func (p point) PrintMovement() {}
+
+func (p point) Crossover(other Individual, r *rand.Rand) Individual {
+	o := other.(point)
+	return point{x: p.x + r.NormFloat64()*(o.x-p.x), y: p.y + r.NormFloat64()*(o.y-p.y)}
+}
+
+func (p point) Mutate(r *rand.Rand) Individual {
+	return point{x: p.x + 10*r.NormFloat64(), y: p.y + 10*r.NormFloat64()}
+}
+
+func TestElitism(t *testing.T) {
+	conf := Config{Population: 10, MutationRate: 1, Workers: 2}.withDefaults()
+	require.Equal(t, 2, conf.Elite)
+	assert.Equal(t, 0, Config{Elite: -1}.withDefaults().Elite)
+
+	r := rand.New(rand.NewSource(1))
+	population := breed(conf, r, func(cr *rand.Rand) Individual {
+		return point{x: 100 * cr.NormFloat64(), y: 100 * cr.NormFloat64()}
+	})
+	// Most children are worse than their parents, but the best individual is always kept
+	for generation := 0; generation < 100; generation++ {
+		next := nextGeneration(conf, population, r)
+		assert.LessOrEqual(t, next[0].energy, population[0].energy, "generation %d", generation)
+		population = next
+	}
+}
@@ -0,0 +1,481 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"solution2/pqueue"
+	"solution2/types"
+	"sync"
+	"sync/atomic"
+)
+
+// Distance between stations which are not connected
+const Unreachable = math.MaxInt32
+
+// Graphs with up to this many stations compute all distances at once with Floyd-Warshall, larger ones run
+// Dijkstra from a station the first time a distance from it is needed
+const floydWarshallLimit = 200
+
+// Graph caches the shortest distance and the next station on the shortest path between every pair of stations.
+// The cache is filled on the first lookup and emptied whenever an edge changes. It is safe for concurrent use, and
+// lookups of what is already computed never wait for a lock.
+// Stations are looked up by name, or by their number in Network for the ...ByID methods.
+type Graph struct {
+	// Held while the edges change or distances are computed
+	mu    sync.Mutex
+	edges types.Graph
+	cache atomic.Pointer[cache]
+}
+
+// Everything computed from one version of the edges, replaced as a whole when an edge changes
+type cache struct {
+	// Stations numbered in sorted order, so that ties between paths are always broken the same way
+	network *types.Network
+	// Shortest distance, next and previous station on the shortest path, by source station, nil until computed
+	rows []atomic.Pointer[row]
+	// Loopless paths found so far between a pair of stations, a *pathList by [2]int
+	kPaths sync.Map
+}
+
+// Paths are never changed once the list is stored, a longer list replaces it
+type pathList struct {
+	paths [][]int
+	// Whether there are no more paths than these
+	complete bool
+}
+
+type row struct {
+	dist []int
+	next []int
+	prev []int
+}
+
+// New creates a graph with a copy of the edges
+func New(edges types.Graph) *Graph {
+	return ForNetwork(edges, nil)
+}
+
+// ForNetwork creates a graph with a copy of the edges whose stations are numbered by network, which must have been
+// made from the same edges. The numbers stay valid until an edge changes. A nil network is made from the edges.
+func ForNetwork(edges types.Graph, network *types.Network) *Graph {
+	g := &Graph{edges: make(types.Graph, len(edges))}
+	for from, to := range edges {
+		g.edges[from] = make(map[string]int, len(to))
+		for station, weight := range to {
+			g.edges[from][station] = weight
+		}
+	}
+	g.invalidate(network)
+	return g
+}
+
+// Network numbering the stations for the ...ByID methods
+func (g *Graph) Network() *types.Network {
+	return g.cache.Load().network
+}
+
+// Weight of the edge between two stations, and whether there is one
+func (g *Graph) Weight(from, to string) (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	w, ok := g.edges[from][to]
+	return w, ok
+}
+
+// SetEdge adds or changes the edge from one station to another, edges only go one way
+func (g *Graph) SetEdge(from, to string, weight int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]int)
+	}
+	if g.edges[to] == nil {
+		g.edges[to] = make(map[string]int)
+	}
+	g.edges[from][to] = weight
+	g.invalidate(nil)
+}
+
+// RemoveEdge removes the edge from one station to another
+func (g *Graph) RemoveEdge(from, to string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.edges[from], to)
+	g.invalidate(nil)
+}
+
+// Distance is the time of the shortest path between two stations, Unreachable when there is none
+func (g *Graph) Distance(from, to string) int {
+	c := g.cache.Load()
+	i, j, ok := c.ids(from, to)
+	if !ok {
+		return Unreachable
+	}
+	return g.row(c, i).dist[j]
+}
+
+// DistanceByID is Distance between two station numbers
+func (g *Graph) DistanceByID(from, to int) int {
+	c := g.cache.Load()
+	return g.row(c, from).dist[to]
+}
+
+// NextHop is the station after from on the shortest path to to, false when there is no path
+func (g *Graph) NextHop(from, to string) (string, bool) {
+	c := g.cache.Load()
+	i, j, ok := c.ids(from, to)
+	if !ok {
+		return "", false
+	}
+	r := g.row(c, i)
+	if r.next[j] < 0 {
+		return "", false
+	}
+	return c.network.Name(r.next[j]), true
+}
+
+// Path is the shortest path between two stations, both included, nil when there is none
+func (g *Graph) Path(from, to string) []string {
+	c := g.cache.Load()
+	i, j, ok := c.ids(from, to)
+	if !ok {
+		return nil
+	}
+	return c.names(g.row(c, i).path(j))
+}
+
+// PathByID is Path between two station numbers
+func (g *Graph) PathByID(from, to int) []int {
+	c := g.cache.Load()
+	return g.row(c, from).path(to)
+}
+
+// Shortest returns the distance and the path between two stations
+func (g *Graph) Shortest(from, to string) (int, []string) {
+	return g.Distance(from, to), g.Path(from, to)
+}
+
+// KShortestPaths returns up to k loopless paths between two stations, shortest first, with Yen's algorithm.
+// Paths of equal time come out with the fewest stations first.
+func (g *Graph) KShortestPaths(from, to string, k int) [][]string {
+	c := g.cache.Load()
+	i, j, ok := c.ids(from, to)
+	if !ok {
+		return nil
+	}
+	found := c.kShortest(i, j, k)
+	paths := make([][]string, len(found))
+	for p := range paths {
+		paths[p] = c.names(found[p])
+	}
+	return paths
+}
+
+// KShortestPathsByID is KShortestPaths between two station numbers. The paths are shared, and must not be changed.
+func (g *Graph) KShortestPathsByID(from, to, k int) [][]int {
+	return g.cache.Load().kShortest(from, to, k)
+}
+
+// Row of the source station, computed if needed
+func (g *Graph) row(c *cache, source int) *row {
+	if r := c.rows[source].Load(); r != nil {
+		return r
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Another goroutine may have computed it while waiting for the lock
+	if r := c.rows[source].Load(); r != nil {
+		return r
+	}
+	if c.network.Len() <= floydWarshallLimit {
+		c.floydWarshall()
+	} else {
+		c.rows[source].Store(c.dijkstra(source))
+	}
+	return c.rows[source].Load()
+}
+
+// Empty the cache. The stations are numbered again as edges may have added some, unless network is given.
+func (g *Graph) invalidate(network *types.Network) {
+	if network == nil {
+		network = types.NewNetwork(g.edges)
+	}
+	g.cache.Store(&cache{network: network, rows: make([]atomic.Pointer[row], network.Len())})
+}
+
+// Numbers of two stations, false when either is unknown
+func (c *cache) ids(from, to string) (int, int, bool) {
+	i, ok := c.network.ID(from)
+	if !ok {
+		return 0, 0, false
+	}
+	j, ok := c.network.ID(to)
+	return i, j, ok
+}
+
+// Names of a path of station numbers
+func (c *cache) names(path []int) []string {
+	if path == nil {
+		return nil
+	}
+	names := make([]string, len(path))
+	for i, id := range path {
+		names[i] = c.network.Name(id)
+	}
+	return names
+}
+
+// Up to k shortest loopless paths, extending the paths found before when there are not enough of them
+func (c *cache) kShortest(source, target, k int) [][]int {
+	if k <= 0 {
+		return nil
+	}
+	key := [2]int{source, target}
+	list := &pathList{}
+	if stored, ok := c.kPaths.Load(key); ok {
+		list = stored.(*pathList)
+	}
+	if len(list.paths) < k && !list.complete {
+		list = c.yen(source, target, k, list)
+		c.kPaths.Store(key, list)
+	}
+
+	if k > len(list.paths) {
+		k = len(list.paths)
+	}
+	return list.paths[:k:k]
+}
+
+// The list extended with the next shortest loopless paths until it has k of them or there are no more
+func (c *cache) yen(source, target, k int, found *pathList) *pathList {
+	list := &pathList{paths: append([][]int{}, found.paths...)}
+	if len(list.paths) == 0 {
+		first := c.searchPath(source, target, nil, nil)
+		if first == nil {
+			list.complete = true
+			return list
+		}
+		list.paths = append(list.paths, first)
+	}
+
+	// Candidates are found again from every path of the list, so nothing has to be kept between calls
+	candidates := make([]candidate, 0)
+	seen := make(map[string]bool)
+	for _, p := range list.paths {
+		seen[fmt.Sprint(p)] = true
+	}
+	removedNodes := make([]bool, c.network.Len())
+	for _, prev := range list.paths {
+		candidates = c.spurPaths(prev, list.paths, removedNodes, seen, candidates)
+	}
+
+	for len(list.paths) < k {
+		if len(candidates) == 0 {
+			list.complete = true
+			return list
+		}
+		best := 0
+		for i := range candidates {
+			if candidates[i].less(candidates[best]) {
+				best = i
+			}
+		}
+		next := candidates[best].nodes
+		candidates = append(candidates[:best], candidates[best+1:]...)
+		list.paths = append(list.paths, next)
+		candidates = c.spurPaths(next, list.paths, removedNodes, seen, candidates)
+	}
+	return list
+}
+
+type candidate struct {
+	nodes []int
+	time  int
+}
+
+func (c candidate) less(other candidate) bool {
+	if c.time != other.time {
+		return c.time < other.time
+	}
+	if len(c.nodes) != len(other.nodes) {
+		return len(c.nodes) < len(other.nodes)
+	}
+	for i := range c.nodes {
+		if c.nodes[i] != other.nodes[i] {
+			return c.nodes[i] < other.nodes[i]
+		}
+	}
+	return false
+}
+
+// Add the paths which leave prev at one of its stations and are not found yet. A path leaving at a station keeps the
+// stations before it, so it may neither visit them again nor take the next edge of a found path with the same start.
+func (c *cache) spurPaths(prev []int, found [][]int, removedNodes []bool, seen map[string]bool, candidates []candidate) []candidate {
+	target := prev[len(prev)-1]
+	for spur := 0; spur < len(prev)-1; spur++ {
+		root := prev[:spur+1]
+		removedEdges := make(map[[2]int]bool)
+		for _, p := range found {
+			if len(p) > spur+1 && equal(p[:spur+1], root) {
+				removedEdges[[2]int{p[spur], p[spur+1]}] = true
+			}
+		}
+		for _, v := range root[:spur] {
+			removedNodes[v] = true
+		}
+
+		if tail := c.searchPath(prev[spur], target, removedNodes, removedEdges); tail != nil {
+			nodes := append(append(make([]int, 0, spur+len(tail)), root[:spur]...), tail...)
+			if key := fmt.Sprint(nodes); !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, candidate{nodes: nodes, time: c.time(nodes)})
+			}
+		}
+
+		for _, v := range root[:spur] {
+			removedNodes[v] = false
+		}
+	}
+	return candidates
+}
+
+// Shortest path avoiding the removed stations and edges, nil when there is none
+func (c *cache) searchPath(source, target int, removedNodes []bool, removedEdges map[[2]int]bool) []int {
+	return c.search(source, target, removedNodes, removedEdges).path(target)
+}
+
+// Time of a path of station numbers
+func (c *cache) time(path []int) int {
+	total := 0
+	for i := 0; i < len(path)-1; i++ {
+		w, _ := c.network.Weight(path[i], path[i+1])
+		total += w
+	}
+	return total
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func newRow(n, source int) *row {
+	r := &row{dist: make([]int, n), next: make([]int, n), prev: make([]int, n)}
+	for i := range r.dist {
+		r.dist[i] = Unreachable
+		r.next[i] = -1
+		r.prev[i] = -1
+	}
+	r.dist[source] = 0
+	return r
+}
+
+// Path from the source of the row to the target, both included, nil when there is none
+func (r *row) path(target int) []int {
+	if r.dist[target] == Unreachable {
+		return nil
+	}
+	length := 1
+	for v := target; r.prev[v] >= 0; v = r.prev[v] {
+		length++
+	}
+	path := make([]int, length)
+	for v := target; v >= 0; v = r.prev[v] {
+		length--
+		path[length] = v
+	}
+	return path
+}
+
+// Fill every row at once
+func (c *cache) floydWarshall() {
+	n := c.network.Len()
+	rows := make([]*row, n)
+	for i := range rows {
+		rows[i] = newRow(n, i)
+		targets, weights := c.network.Neighbours(i)
+		for e, j := range targets {
+			if w := weights[e]; i != j && w < rows[i].dist[j] {
+				rows[i].dist[j] = w
+				rows[i].next[j] = j
+				rows[i].prev[j] = i
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		through := rows[k]
+		for i := 0; i < n; i++ {
+			r := rows[i]
+			if r.dist[k] == Unreachable {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if through.dist[j] == Unreachable {
+					continue
+				}
+				if d := r.dist[k] + through.dist[j]; d < r.dist[j] {
+					r.dist[j] = d
+					r.next[j] = r.next[k]
+					r.prev[j] = through.prev[j]
+				}
+			}
+		}
+	}
+	// Rows are only published once complete
+	for i, r := range rows {
+		c.rows[i].Store(r)
+	}
+}
+
+// Row of a single source
+func (c *cache) dijkstra(source int) *row {
+	return c.search(source, -1, nil, nil)
+}
+
+// Dijkstra from source which never enters the removed stations or takes the removed edges. The search stops once the
+// target is settled, pass -1 to settle every station.
+func (c *cache) search(source, target int, removedNodes []bool, removedEdges map[[2]int]bool) *row {
+	r := newRow(c.network.Len(), source)
+	pq := pqueue.NewIndexedPQ(c.network.Len())
+	pq.Push(source, 0)
+
+	for pq.Len() > 0 {
+		u, _ := pq.Pop()
+		if u == target {
+			break
+		}
+		// The first station of the path is the one after the source
+		if r.prev[u] == source {
+			r.next[u] = u
+		} else if r.prev[u] >= 0 {
+			r.next[u] = r.next[r.prev[u]]
+		}
+
+		targets, weights := c.network.Neighbours(u)
+		for e, v := range targets {
+			if removedNodes != nil && removedNodes[v] || removedEdges[[2]int{u, v}] {
+				continue
+			}
+			alt := r.dist[u] + weights[e]
+			if alt >= r.dist[v] {
+				continue
+			}
+			r.dist[v] = alt
+			r.prev[v] = u
+			if pq.Contains(v) {
+				pq.DecreaseKey(v, alt)
+			} else {
+				pq.Push(v, alt)
+			}
+		}
+	}
+	return r
+}
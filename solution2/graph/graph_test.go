@@ -0,0 +1,218 @@
+package graph
+
+import (
+	"fmt"
+	"math/rand"
+	"solution2/types"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Undirected graph with random edges between n stations
+func randomEdges(n int, r *rand.Rand) types.Graph {
+	edges := make(types.Graph)
+	for i := 0; i < n; i++ {
+		edges[fmt.Sprint("S", i)] = make(map[string]int)
+	}
+	for i := 0; i < 3*n; i++ {
+		from, to, w := fmt.Sprint("S", r.Intn(n)), fmt.Sprint("S", r.Intn(n)), 1+r.Intn(20)
+		if from != to {
+			edges[from][to] = w
+			edges[to][from] = w
+		}
+	}
+	return edges
+}
+
+func TestShortestPaths(t *testing.T) {
+	edges := randomEdges(30, rand.New(rand.NewSource(1)))
+	g := New(edges)
+	g.Distance("S0", "S0")
+
+	// Floyd-Warshall and Dijkstra agree on every distance
+	c := g.cache.Load()
+	for i := 0; i < c.network.Len(); i++ {
+		assert.Equal(t, c.rows[i].Load().dist, c.dijkstra(i).dist, c.network.Name(i))
+	}
+
+	for from := range edges {
+		for to := range edges {
+			d, path := g.Shortest(from, to)
+			if d == Unreachable {
+				assert.Nil(t, path)
+				continue
+			}
+
+			// The path starts and ends at the stations, and its edges add up to the distance
+			assert.Equal(t, from, path[0])
+			assert.Equal(t, to, path[len(path)-1])
+			sum := 0
+			for i := 0; i < len(path)-1; i++ {
+				w, ok := g.Weight(path[i], path[i+1])
+				assert.True(t, ok)
+				sum += w
+			}
+			assert.Equal(t, d, sum)
+
+			next, ok := g.NextHop(from, to)
+			assert.Equal(t, from != to, ok)
+			if ok {
+				assert.Equal(t, path[1], next)
+			}
+		}
+	}
+}
+
+func TestEdgeChanges(t *testing.T) {
+	edges := types.Graph{"A": {"B": 10}, "B": {"A": 10, "C": 10}, "C": {"B": 10}}
+	g := New(edges)
+	assert.Equal(t, 20, g.Distance("A", "C"))
+	assert.Equal(t, []string{"A", "B", "C"}, g.Path("A", "C"))
+
+	// A shortcut is used as soon as it is added, and the edges given to New are left alone
+	g.SetEdge("A", "C", 5)
+	assert.Equal(t, 5, g.Distance("A", "C"))
+	assert.Equal(t, []string{"A", "C"}, g.Path("A", "C"))
+	assert.NotContains(t, edges["A"], "C")
+
+	g.RemoveEdge("A", "C")
+	g.RemoveEdge("B", "C")
+	assert.Equal(t, Unreachable, g.Distance("A", "C"))
+	assert.Nil(t, g.Path("A", "C"))
+	_, ok := g.NextHop("A", "C")
+	assert.False(t, ok)
+
+	// New stations come with their edges
+	g.SetEdge("C", "D", 1)
+	assert.Equal(t, 1, g.Distance("C", "D"))
+	assert.Equal(t, Unreachable, g.Distance("X", "A"))
+}
+
+func TestLargeGraph(t *testing.T) {
+	n := floydWarshallLimit + 100
+	g := New(randomEdges(n, rand.New(rand.NewSource(1))))
+
+	// Above the limit only the rows which are looked up are computed, with Dijkstra
+	g.Distance("S0", "S1")
+	c := g.cache.Load()
+	computed := 0
+	for i := range c.rows {
+		if c.rows[i].Load() != nil {
+			computed++
+		}
+	}
+	assert.Equal(t, 1, computed)
+
+	dijkstra := make([][]int, n)
+	for i := range dijkstra {
+		dijkstra[i] = c.dijkstra(i).dist
+	}
+	c.floydWarshall()
+	for i := range dijkstra {
+		assert.Equal(t, c.rows[i].Load().dist, dijkstra[i], c.network.Name(i))
+	}
+}
+
+func TestLookupByID(t *testing.T) {
+	edges := randomEdges(30, rand.New(rand.NewSource(3)))
+	network := types.NewNetwork(edges)
+	g := ForNetwork(edges, network)
+	assert.Same(t, network, g.Network())
+
+	// Lookups by number give the same answers as by name, also while other goroutines fill the cache
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < network.Len(); i++ {
+				for j := 0; j < network.Len(); j++ {
+					from, to := network.Name(i), network.Name(j)
+					assert.Equal(t, g.Distance(from, to), g.DistanceByID(i, j))
+					path := g.PathByID(i, j)
+					if path == nil {
+						assert.Nil(t, g.Path(from, to))
+					} else {
+						named := make([]string, len(path))
+						for v, id := range path {
+							named[v] = network.Name(id)
+						}
+						assert.Equal(t, g.Path(from, to), named)
+					}
+					assert.Len(t, g.KShortestPathsByID(i, j, 3), len(g.KShortestPaths(from, to, 3)))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Times of every loopless path between two stations, found by depth first search
+func allPathTimes(edges types.Graph, from, to string) []int {
+	times := make([]int, 0)
+	visited := map[string]bool{from: true}
+	var walk func(station string, time int)
+	walk = func(station string, time int) {
+		if station == to {
+			times = append(times, time)
+			return
+		}
+		for next, w := range edges[station] {
+			if !visited[next] {
+				visited[next] = true
+				walk(next, time+w)
+				visited[next] = false
+			}
+		}
+	}
+	walk(from, 0)
+	sort.Ints(times)
+	return times
+}
+
+func TestKShortestPaths(t *testing.T) {
+	edges := randomEdges(8, rand.New(rand.NewSource(2)))
+	g := New(edges)
+
+	for from := range edges {
+		for to := range edges {
+			want := allPathTimes(edges, from, to)
+			if len(want) > 10 {
+				want = want[:10]
+			}
+			paths := g.KShortestPaths(from, to, 10)
+			times := make([]int, len(paths))
+			seen := make(map[string]bool)
+			for p, path := range paths {
+				// Every path goes from one station to the other without visiting a station twice
+				assert.Equal(t, from, path[0])
+				assert.Equal(t, to, path[len(path)-1])
+				stations := make(map[string]bool)
+				for i, station := range path {
+					assert.False(t, stations[station], "%v visits %s twice", path, station)
+					stations[station] = true
+					if i > 0 {
+						w, ok := g.Weight(path[i-1], station)
+						assert.True(t, ok)
+						times[p] += w
+					}
+				}
+				assert.False(t, seen[fmt.Sprint(path)], "%v found twice", path)
+				seen[fmt.Sprint(path)] = true
+			}
+			assert.Equal(t, want, times, "%s to %s", from, to)
+		}
+	}
+
+	// Asking for more paths extends the cached ones
+	g = New(edges)
+	few := g.KShortestPaths("S0", "S1", 2)
+	many := g.KShortestPaths("S0", "S1", 10)
+	assert.Equal(t, few, many[:len(few)])
+	assert.Equal(t, many, New(edges).KShortestPaths("S0", "S1", 10))
+	assert.Equal(t, [][]string{{"S0"}}, g.KShortestPaths("S0", "S0", 3))
+	assert.Nil(t, g.KShortestPaths("S0", "X", 3))
+}
@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	problem, err := Initialize("../test/test1.txt")
+	require.NoError(t, err)
+	assert.Len(t, problem.Graph, 3)
+	assert.Equal(t, 30, problem.Graph["A"]["B"])
+	assert.Equal(t, "C", problem.Package["K1"].Destination)
+	assert.Equal(t, 6, problem.Train["Q1"].Capacity)
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		input   string
+		line    int
+		section string
+		field   string
+		err     error
+	}{
+		{"x\n", 1, SectionStations, "count", strconv.ErrSyntax},
+		{"2\nA\n", 3, SectionStations, "name", ErrUnexpectedEOF},
+		{"2\nA\nB\n\n1\nE1,A,B\n", 6, SectionEdges, "edge", ErrFieldCount},
+		{"2\nA\nB\n\n1\nE1,A,B,ten\n", 6, SectionEdges, "weight", strconv.ErrSyntax},
+		{"2\nA\nB\n\n1\nE1,A,B,1\n\n1\nK1,heavy,A,B\n", 9, SectionDeliveries, "weight", strconv.ErrSyntax},
+		{"2\nA\nB\n\n1\nE1,A,B,1\n\n1\nK1,1,A,B\n\n1\nQ1,1\n", 12, SectionTrains, "train", ErrFieldCount},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(strings.NewReader(c.input))
+		var parseErr *ParseError
+		require.True(t, errors.As(err, &parseErr), c.input)
+		assert.Equal(t, c.line, parseErr.Line, c.input)
+		assert.Equal(t, c.section, parseErr.Section, c.input)
+		assert.Equal(t, c.field, parseErr.Field, c.input)
+		assert.ErrorIs(t, err, c.err, c.input)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	problem, err := Initialize("../test/test2.txt")
+	require.NoError(t, err)
+	assert.NoError(t, Validate(problem))
+
+	input := "3\nA\nB\nA\n\n2\nE1,A,B,5\nE2,B,X,5\n\n3\nK1,50,A,B\nK2,1,C,B\nK3,1,B,B\n\n1\nQ1,10,A\n"
+	problem, err = Parse(strings.NewReader(input))
+	require.NoError(t, err)
+
+	err = Validate(problem)
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []Violation{
+		{Section: SectionStations, Name: "A", Reason: "duplicate name"},
+		{Section: SectionEdges, Name: "E2", Reason: `unknown station "X"`},
+		{Section: SectionDeliveries, Name: "K1", Reason: "weight 50 exceeds the capacity of every train"},
+		{Section: SectionDeliveries, Name: "K2", Reason: `unknown station "C"`},
+		{Section: SectionDeliveries, Name: "K3", Reason: "starts at its destination B"},
+		{Section: SectionDeliveries, Reason: "total weight 52 exceeds the total capacity 10 of the trains"},
+	}, validationErr.Violations)
+	assert.Contains(t, err.Error(), "deliveries: total weight 52")
+}
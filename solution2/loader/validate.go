@@ -0,0 +1,180 @@
+package loader
+
+import (
+	"fmt"
+	"solution2/types"
+	"strings"
+)
+
+// Violation is a single semantic problem found in a loaded problem
+type Violation struct {
+	Section string
+	Name    string
+	Reason  string
+}
+
+func (v Violation) String() string {
+	if v.Name == "" {
+		return fmt.Sprintf("%s: %s", v.Section, v.Reason)
+	}
+	return fmt.Sprintf("%s %s: %s", v.Section, v.Name, v.Reason)
+}
+
+// ValidationError collects every violation found by Validate
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msg := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msg[i] = v.String()
+	}
+	return fmt.Sprintf("%d validation error(s): %s", len(e.Violations), strings.Join(msg, "; "))
+}
+
+// Validate checks that the problem is consistent and that every package can be delivered.
+// All violations are reported at once in a *ValidationError.
+func Validate(problem types.Problem) error {
+	var violations []Violation
+	report := func(section, name, format string, args ...any) {
+		violations = append(violations, Violation{Section: section, Name: name, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	// Stations
+	stations := make(map[string]bool)
+	for _, s := range problem.Stations {
+		if stations[s] {
+			report(SectionStations, s, "duplicate name")
+		}
+		stations[s] = true
+	}
+
+	// Edges, only edges between declared stations are used for the reachability check below
+	adjacency := make(map[string][]string)
+	edges := make(map[string]bool)
+	for _, e := range problem.Edges {
+		if edges[e.Name] {
+			report(SectionEdges, e.Name, "duplicate name")
+		}
+		edges[e.Name] = true
+		if e.Weight < 0 {
+			report(SectionEdges, e.Name, "negative weight %d", e.Weight)
+		}
+		valid := true
+		for _, s := range []string{e.From, e.To} {
+			if !stations[s] {
+				report(SectionEdges, e.Name, "unknown station %q", s)
+				valid = false
+			}
+		}
+		if valid {
+			adjacency[e.From] = append(adjacency[e.From], e.To)
+			adjacency[e.To] = append(adjacency[e.To], e.From)
+		}
+	}
+	component := connectedComponents(problem.Stations, adjacency)
+
+	// Trains
+	trains := make(map[string]bool)
+	for _, t := range problem.Trains {
+		if trains[t.Name] {
+			report(SectionTrains, t.Name, "duplicate name")
+		}
+		trains[t.Name] = true
+		if t.Capacity < 0 {
+			report(SectionTrains, t.Name, "negative capacity %d", t.Capacity)
+		}
+		if !stations[t.StartAt] {
+			report(SectionTrains, t.Name, "unknown station %q", t.StartAt)
+		}
+	}
+
+	// Packages
+	packages := make(map[string]bool)
+	for _, p := range problem.Packages {
+		if packages[p.Name] {
+			report(SectionDeliveries, p.Name, "duplicate name")
+		}
+		packages[p.Name] = true
+		if p.Weight < 0 {
+			report(SectionDeliveries, p.Name, "negative weight %d", p.Weight)
+		}
+
+		known := true
+		for _, s := range []string{p.StartAt, p.Destination} {
+			if !stations[s] {
+				report(SectionDeliveries, p.Name, "unknown station %q", s)
+				known = false
+			}
+		}
+
+		// Find a train which is able to carry the package and reach it
+		fits, reaches := false, false
+		for _, t := range problem.Trains {
+			if t.Capacity >= p.Weight {
+				fits = true
+				if known && stations[t.StartAt] && component[t.StartAt] == component[p.StartAt] {
+					reaches = true
+				}
+			}
+		}
+		if !fits {
+			report(SectionDeliveries, p.Name, "weight %d exceeds the capacity of every train", p.Weight)
+		}
+		if !known {
+			continue
+		}
+		if p.StartAt == p.Destination {
+			report(SectionDeliveries, p.Name, "starts at its destination %s", p.StartAt)
+		}
+		if component[p.StartAt] != component[p.Destination] {
+			report(SectionDeliveries, p.Name, "destination %s is unreachable from %s", p.Destination, p.StartAt)
+		}
+		if fits && !reaches {
+			report(SectionDeliveries, p.Name, "no train able to carry it can reach %s", p.StartAt)
+		}
+	}
+
+	// A train carries all of its packages at once, so together they have to fit on the trains
+	weight, capacity := 0, 0
+	for _, p := range problem.Packages {
+		weight += p.Weight
+	}
+	for _, t := range problem.Trains {
+		capacity += t.Capacity
+	}
+	if weight > capacity {
+		report(SectionDeliveries, "", "total weight %d exceeds the total capacity %d of the trains", weight, capacity)
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Label every station with the index of the connected component it belongs to
+func connectedComponents(stations []string, adjacency map[string][]string) map[string]int {
+	component := make(map[string]int)
+	id := 0
+	for _, s := range stations {
+		if _, ok := component[s]; ok {
+			continue
+		}
+		id++
+		component[s] = id
+		stack := []string{s}
+		for len(stack) > 0 {
+			curr := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, n := range adjacency[curr] {
+				if _, ok := component[n]; !ok {
+					component[n] = id
+					stack = append(stack, n)
+				}
+			}
+		}
+	}
+	return component
+}
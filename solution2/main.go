@@ -1,15 +1,24 @@
 package main
 
 import (
-	"container/heap"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"solution2/alns"
 	"solution2/anneal"
+	"solution2/genetic"
+	"solution2/graph"
 	"solution2/loader"
-	"solution2/pqueue"
+	"solution2/mip"
+	"solution2/tabu"
 	"solution2/types"
 	"sort"
+	"time"
 )
 
 type State struct {
@@ -17,164 +26,494 @@ type State struct {
 	TrainPickedUp   map[string][]string
 	Move            []Move
 	Route           map[string][]string
-	Graph           types.Graph
-	Train           map[string]*types.Train
-	Package         map[string]*types.Package
+	// Packages which stay on board after their pickup until the train has picked up the next package of its sequence,
+	// instead of being delivered right away
+	Deferred  map[string]bool
+	Router    Router
+	Train     map[string]*types.Train
+	Package   map[string]*types.Package
+	Objective Objective
 }
 
+// Move of a train along one edge, times are on the train's own clock
 type Move struct {
-	TimeTaken      int
-	Train          string
-	StartNode      string
-	EndNode        string
-	PickedPackage  []string
+	Start     int
+	End       int
+	Train     string
+	StartNode string
+	EndNode   string
+	// Packages picked up at the start node
+	PickedPackage []string
+	// Packages dropped off at the end node
 	DroppedPackage []string
+	// Number of the leg of the train's route the move belongs to, and which of the router's paths the leg follows
+	Leg  int
+	Path int
 }
 
 func main() {
-	train, pkg, graph := loader.Initialize("example.txt")
-	t := assignPkgToTrain(graph, train, pkg)
-	r, m := planRoute(graph, t, train, pkg)
+	solver := flag.String("solver", "anneal", "solver to use: anneal, tabu, genetic, alns, or exact for a proven optimal plan of a small instance")
+	objectiveName := flag.String("objective", "total", "objective to minimise: total, makespan or weighted")
+	makespanWeight := flag.Float64("makespan-weight", 0.5, "share of the makespan in the weighted objective")
+	budget := flag.Duration("budget", 0, "wall clock budget of the solver, 0 for no limit")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the random number generator, the same seed always gives the same plan")
+	reheat := flag.Uint("reheat", 0, "reheat after this many iterations without improvement, 0 to disable")
+	restart := flag.Uint("restart", 0, "restart from a fresh random state after this many iterations without improvement, 0 to disable")
+	chains := flag.Int("chains", 1, "number of annealing chains run in parallel")
+	workers := flag.Int("workers", 0, "number of chains running at the same time, 0 for the number of CPUs")
+	share := flag.Uint("share", 0, "share the best plan between the chains every this many iterations, 0 to disable")
+	plan := flag.String("plan", "", "check and score the plan in this file, a dispatch schedule or a solution of the exported model, instead of solving")
+	export := flag.String("export", "", "write the problem as a MIP model to this .lp or .mps file instead of solving it")
+	routing := flag.String("routing", defaultRouting, "path of every leg: shortest, k-shortest (one of the k shortest paths at random) or random")
+	k := flag.Int("k", 3, "number of paths to pick from with -routing k-shortest")
+	replicas := flag.Int("replicas", 1, "number of replicas for parallel tempering, used instead of annealing when above 1")
+	flag.Parse()
+
+	objective, err := ParseObjective(*objectiveName, *makespanWeight)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	policy, err := ParseRoutingPolicy(*routing)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	problem, err := loader.Initialize("example.txt")
+	if err == nil {
+		err = loader.Validate(problem)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *export != "" {
+		if err := exportModel(*export, problem, objective); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// Shortest paths between the stations, shared by the solvers
+	router := newRouter(problem, policy)
+	router.K = *k
+	paths := router.Paths
+	fmt.Fprintln(os.Stderr, "seed:", *seed)
+	rng := rand.New(rand.NewSource(*seed))
+	initialState, err := newState(problem, objective, router, rng)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Random state for restarts and the first generation, the initial state when no other assignment is found
+	fresh := func(r *rand.Rand) State {
+		s, err := newState(problem, objective, router, r)
+		if err != nil {
+			return initialState
+		}
+		return s
+	}
+
+	conf := anneal.Config{Iteration: 10000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: *seed, TimeBudget: *budget}
+	if *reheat > 0 {
+		conf.Reheat = &anneal.Reheat{Patience: *reheat}
+	}
+	if *restart > 0 {
+		conf.Restart = &anneal.Restart{Patience: *restart, From: anneal.RestartFresh, Fresh: func(r *rand.Rand) anneal.State {
+			return fresh(r)
+		}}
+	}
+
+	var res anneal.Result
+	switch {
+	case *plan != "":
+		imported, err := importPlan(*plan, problem, objective)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		res = anneal.Result{State: imported, Energy: imported.Energy()}
+	case *solver == "tabu":
+		res = tabu.Search(context.Background(), initialState, tabu.Config{Iteration: conf.Iteration, Seed: *seed, TimeBudget: *budget})
+	case *solver == "genetic":
+		// Every individual of the first generation is a fresh random plan
+		individual := func(r *rand.Rand) genetic.Individual {
+			return fresh(r)
+		}
+		res = genetic.Evolve(context.Background(), individual, genetic.Config{Population: 50, Generations: 200, Workers: *workers, Seed: *seed, TimeBudget: *budget})
+	case *solver == "alns":
+		destroy, repair := alnsOperators(paths)
+		res = alns.Search(context.Background(), initialState, alns.Config{Config: conf, Destroy: destroy, Repair: repair})
+	case *solver == "exact":
+		optimal, err := solveExact(problem, objective)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		res = anneal.Result{State: optimal, Energy: optimal.Energy()}
+	case *solver != "anneal":
+		fmt.Fprintf(os.Stderr, "unknown solver %q\n", *solver)
+		os.Exit(1)
+	case *replicas > 1:
+		// The hottest replica accepts most worse plans, the coldest anneals at the final temperature
+		hottest := anneal.Calibrate(initialState, rng, 200, 0.8)
+		ladder := anneal.GeometricLadder(conf.FinalTemperature, math.Max(hottest, conf.FinalTemperature), *replicas)
+		res = anneal.Tempering(context.Background(), initialState, anneal.TemperingConfig{Temperatures: ladder, Iteration: conf.Iteration, Workers: *workers, Seed: *seed, TimeBudget: *budget})
+	case *chains > 1:
+		res = anneal.Parallel(context.Background(), initialState, conf, anneal.ParallelConfig{Chains: *chains, Workers: *workers, ShareEvery: *share})
+	default:
+		res = anneal.Init(context.Background(), initialState, conf)
+	}
+	res.State.PrintMovement()
+
+	// How far the plan can be from the optimal plan at most
+	bound := lowerBound(problem, paths)
+	fmt.Printf("\n// Lower bound %d minutes, the plan is at most %.1f%% slower than the optimal plan.\n", int(bound), 100*gap(res.Energy, bound))
+}
+
+// Create a random initial state for the problem
+func newState(problem types.Problem, objective Objective, router Router, r *rand.Rand) (State, error) {
+	t, err := assignPkgToTrain(router, problem.Train, problem.Package, r)
+	if err != nil {
+		return State{}, err
+	}
+	route, move, err := planRoute(router, t, nil, problem.Train, r)
+	if err != nil {
+		return State{}, err
+	}
+	return State{TrainAssignment: t, Route: route, Move: move, Router: router, Train: problem.Train, Package: problem.Package, Objective: objective}, nil
+}
 
-	initialState := State{TrainAssignment: t, Route: r, Move: m, Graph: graph, Train: train, Package: pkg}
+// Write the problem as a MIP model in the LP or MPS format, chosen by the extension of the path
+func exportModel(path string, problem types.Problem, objective Objective) error {
+	weight := map[ObjectiveKind]float64{TotalTime: 0, Makespan: 1, Weighted: objective.MakespanWeight}[objective.Kind]
+	model := mip.Build(problem, graph.New(problem.Graph).Distance, weight)
+
+	write := model.WriteLP
+	switch filepath.Ext(path) {
+	case ".lp":
+	case ".mps":
+		write = model.WriteMPS
+	default:
+		return fmt.Errorf("unknown model format %q, use .lp or .mps", filepath.Ext(path))
+	}
 
-	s := anneal.Init(initialState, anneal.Config{Iteration: 10000, Temperature: 25000, AneallingFactor: 0.99})
-	s.PrintMovement()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
+// Energy takes the time every train finishes its last move, waits included, then applies the objective
 func (s State) Energy() float64 {
-	var timeTaken float64
+	timeTaken := make(map[string]int)
 
 	for trainName := range s.Train {
-		route := s.Route[trainName]
-		for i := 0; i < len(route)-1; i++ {
-			timeTaken += float64(s.Graph[route[i]][route[i+1]])
+		timeTaken[trainName] = 0
+	}
+	for _, m := range s.Move {
+		if m.End > timeTaken[m.Train] {
+			timeTaken[m.Train] = m.End
 		}
 	}
-	return timeTaken
+	return s.Objective.Evaluate(timeTaken)
 }
 
 func (s State) PrintMovement() {
 	for _, each := range s.Move {
-		fmt.Printf("W=%d, T=%s, N1=%s, P1=%v, N2=%s P2=%v\n", each.TimeTaken, each.Train, each.StartNode, each.PickedPackage, each.EndNode, each.DroppedPackage)
+		fmt.Printf("W=%d, T=%s, N1=%s, P1=%v, N2=%s P2=%v\n", each.Start, each.Train, each.StartNode, each.PickedPackage, each.EndNode, each.DroppedPackage)
 	}
 	fmt.Printf("// Takes %d mintues total.", int(s.Energy()))
 }
 
-func (s State) Neighbor() anneal.State {
-	newState := s
+// Share of the neighbors which switch a leg to another path, when the router has several
+const rerouteRate = 0.2
+
+// Share of the neighbors which defer the delivery of a package, or deliver it right after its pickup again
+const deferRate = 0.2
+
+func (s State) Neighbor(r *rand.Rand) anneal.State {
+	newState, _ := s.NeighborMove(r)
+	return newState
+}
+
+// NeighborMove returns a neighbor together with the move that produced it, for tabu search. The move is empty when
+// the neighbor is the unchanged state, like a swap of a package with itself or a reassignment to a full train.
+// A reassignment of package K to train Q has the key "assign K Q", a swap within train Q the key "swap Q K1 K2".
+// With KShortestPaths a leg L of train Q can also switch to path P, with the key "route Q L P". Deferring the
+// delivery of package K or delivering it right away again has the key "defer K".
+func (s State) NeighborMove(r *rand.Rand) (tabu.State, tabu.Move) {
+	if s.Router.Policy == KShortestPaths && r.Float64() < rerouteRate {
+		return s.reroute(r)
+	}
+	if r.Float64() < deferRate {
+		return s.toggleDeferred(r)
+	}
+	newState := s.clone()
+	move := tabu.Move{}
 	// Generate 2 random train
-	train1 := s.getRandomTrain()
-	train2 := s.getRandomTrain()
-	if rand.Float64() > 0.5 && train1 != train2 && len(newState.TrainAssignment[train1]) > 0 {
+	train1 := s.getRandomTrain(r)
+	train2 := s.getRandomTrain(r)
+	if r.Float64() > 0.5 && train1 != train2 && len(newState.TrainAssignment[train1]) > 0 {
 		// Swap train1's package assignment to train 2
-		i := rand.Intn(len(newState.TrainAssignment[train1]))
+		i := r.Intn(len(newState.TrainAssignment[train1]))
 		pkgToReassign := newState.TrainAssignment[train1][i]
-		if newState.Train[train2].CurrentCapacity >= newState.Package[pkgToReassign].Weight {
+		if newState.load(train2)+newState.Package[pkgToReassign].Weight <= newState.Train[train2].Capacity && s.Router.reaches(s.Train[train2], s.Package[pkgToReassign]) {
 			// Remove from the train1
 			newState.TrainAssignment[train1] = append(newState.TrainAssignment[train1][:i], newState.TrainAssignment[train1][i+1:]...)
-			newState.Train[train1].CurrentCapacity += newState.Package[pkgToReassign].Weight
 			// Assign to train2
 			newState.TrainAssignment[train2] = append(newState.TrainAssignment[train2], pkgToReassign)
-			newState.Train[train2].CurrentCapacity -= newState.Package[pkgToReassign].Weight
-
-			// reset the package to not picked up
-			newState.reset()
-
-			route, move := planRoute(newState.Graph, newState.TrainAssignment, newState.Train, newState.Package)
-			newState.Route = route
-			newState.Move = move
+			move = tabu.Move{Key: "assign " + pkgToReassign + " " + train2, Reverse: "assign " + pkgToReassign + " " + train1}
+			if err := newState.replan(s.legChoices(train1, train2), r); err != nil {
+				return s, tabu.Move{}
+			}
 		}
 
 	} else {
 		// Swap package within a train and regenerate new route for the train
 		if len(newState.TrainAssignment[train1]) > 0 {
-			i := rand.Intn(len(newState.TrainAssignment[train1]))
-			j := rand.Intn(len(newState.TrainAssignment[train1]))
+			i := r.Intn(len(newState.TrainAssignment[train1]))
+			j := r.Intn(len(newState.TrainAssignment[train1]))
 
 			newState.TrainAssignment[train1][i], newState.TrainAssignment[train1][j] = newState.TrainAssignment[train1][j], newState.TrainAssignment[train1][i]
+			if i != j {
+				pair := []string{newState.TrainAssignment[train1][i], newState.TrainAssignment[train1][j]}
+				sort.Strings(pair)
+				key := "swap " + train1 + " " + pair[0] + " " + pair[1]
+				move = tabu.Move{Key: key, Reverse: key}
+			}
+			if err := newState.replan(s.legChoices(train1), r); err != nil {
+				return s, tabu.Move{}
+			}
+		}
+	}
+	return newState, move
+}
 
-			// Reset
-			newState.reset()
+// Switch a random leg of a random train to another of the K shortest paths, the other legs keep their paths.
+// Packages picked up on the way can change the legs after it, which keep their path where they join the same stations.
+func (s State) reroute(r *rand.Rand) (State, tabu.Move) {
+	newState := s.clone()
+	t := s.getRandomTrain(r)
+	moves := make([]Move, 0)
+	for _, m := range s.Move {
+		if m.Train == t {
+			moves = append(moves, m)
+		}
+	}
+	if len(moves) == 0 {
+		return newState, tabu.Move{}
+	}
 
-			route, move := planRoute(newState.Graph, newState.TrainAssignment, newState.Train, newState.Package)
-			newState.Route = route
-			newState.Move = move
+	legs := make([]Move, 0)
+	for _, m := range moves {
+		if len(legs) == 0 || legs[len(legs)-1].Leg != m.Leg {
+			legs = append(legs, m)
 		}
 	}
-	return newState
+	m := legs[r.Intn(len(legs))]
+	var start, end string
+	for _, each := range moves {
+		if each.Leg == m.Leg {
+			if start == "" {
+				start = each.StartNode
+			}
+			end = each.EndNode
+		}
+	}
+	from, _ := s.Router.Network.ID(start)
+	to, _ := s.Router.Network.ID(end)
+	alternatives := len(s.Router.kShortest(from, to, s.Router.k()))
+	if alternatives < 2 {
+		return newState, tabu.Move{}
+	}
+	choice := r.Intn(alternatives - 1)
+	if choice >= m.Path {
+		choice++
+	}
+
+	choices := s.legChoices(t)
+	choices[t][[2]int{from, to}] = choice
+	if err := newState.replan(choices, r); err != nil {
+		return s, tabu.Move{}
+	}
+
+	key := fmt.Sprintf("route %s %d ", t, m.Leg)
+	return newState, tabu.Move{Key: key + fmt.Sprint(choice), Reverse: key + fmt.Sprint(m.Path)}
 }
 
-// Get random train
-func (s State) getRandomTrain() string {
-	trainName := make([]string, 0, len(s.Train))
-	for n := range s.Train {
-		trainName = append(trainName, n)
+// Defer the delivery of a random package, or deliver it right after its pickup again, and plan its train again
+func (s State) toggleDeferred(r *rand.Rand) (State, tabu.Move) {
+	pkgs := sortedKeys(s.Package)
+	if len(pkgs) == 0 {
+		return s, tabu.Move{}
 	}
-	tName := trainName[rand.Intn(len(trainName))]
-	return tName
+	p := pkgs[r.Intn(len(pkgs))]
+	newState := s.clone()
+	newState.Deferred = toggled(s.Deferred, p)
+
+	var train string
+	for t, sequence := range s.TrainAssignment {
+		for _, each := range sequence {
+			if each == p {
+				train = t
+			}
+		}
+	}
+	if err := newState.replan(s.legChoices(train), r); err != nil {
+		return s, tabu.Move{}
+	}
+	key := "defer " + p
+	return newState, tabu.Move{Key: key, Reverse: key}
 }
 
-// Reset some state, typically every iteration
-func (s State) reset() {
-	for _, each := range s.Package {
-		each.Picked = false
+// Copy of the deferred packages with the delivery of the package deferred, or no longer deferred
+func toggled(deferred map[string]bool, pkg string) map[string]bool {
+	newDeferred := make(map[string]bool, len(deferred)+1)
+	for p, ok := range deferred {
+		if ok && p != pkg {
+			newDeferred[p] = true
+		}
 	}
-	for _, each := range s.Train {
-		each.CurrentLocation = each.StartAt
-		each.PickedPackage = make([]string, 0)
-		each.DroppedPackage = make([]string, 0)
+	if !deferred[pkg] {
+		newDeferred[pkg] = true
 	}
+	return newDeferred
 }
 
-// Djikstra shortest distance
-func shortestDistance(graph types.Graph, start, end string) (int, []string) {
-	pq := make(pqueue.DistancePQ, len(graph))
-	duration := make(map[string]int)
-	prev := make(map[string]string)
-
-	i := 0
-	for v := range graph {
-		duration[v] = math.MaxInt32
-		if v == start {
-			duration[v] = 0
-		}
-		pq[i] = &pqueue.Node{Name: v, Duration: duration[v]}
-		i++
-	}
-
-	heap.Init(&pq)
-
-	for pq.Len() > 0 {
-		node := heap.Pop(&pq).(*pqueue.Node)
-		for dest, dur := range graph[node.Name] {
-			alt := duration[node.Name] + dur
-			if alt < duration[dest] {
-				duration[dest] = alt
-				prev[dest] = node.Name
-				for i := 0; i < pq.Len(); i++ {
-					if pq[i].Name == dest {
-						pq[i].Duration = alt
-						heap.Fix(&pq, i)
-					}
-				}
-			}
+// Path of every leg of the trains by the stations it joins, legs without moves stay at one station and have a single
+// path
+func (s State) legChoices(trains ...string) map[string]map[[2]int]int {
+	choices := make(map[string]map[[2]int]int, len(trains))
+	for _, t := range trains {
+		choices[t] = make(map[[2]int]int)
+	}
+	// Stations every leg of the trains joins, in the order of the legs
+	type stops struct{ leg, from, to, path int }
+	legs := make(map[string][]stops, len(trains))
+	for _, m := range s.Move {
+		if _, ok := choices[m.Train]; !ok {
+			continue
+		}
+		from, _ := s.Router.Network.ID(m.StartNode)
+		to, _ := s.Router.Network.ID(m.EndNode)
+		if n := len(legs[m.Train]); n > 0 && legs[m.Train][n-1].leg == m.Leg {
+			legs[m.Train][n-1].to = to
+		} else {
+			legs[m.Train] = append(legs[m.Train], stops{leg: m.Leg, from: from, to: to, path: m.Path})
 		}
 	}
+	for t, each := range legs {
+		for _, l := range each {
+			choices[t][[2]int{l.from, l.to}] = l.path
+		}
+	}
+	return choices
+}
+
+// Plan the routes of the trains of choices again, their legs following the given paths. The other trains keep their
+// routes and moves. The state is left unchanged when a train cannot reach one of its stops.
+func (s *State) replan(choices map[string]map[[2]int]int, r *rand.Rand) error {
+	assignment := make(map[string][]string, len(choices))
+	for t := range choices {
+		assignment[t] = s.TrainAssignment[t]
+	}
+	route, planned, err := planLegs(s.Router, assignment, s.Deferred, s.Train, choices, r)
+	if err != nil {
+		return err
+	}
+
+	newRoute := make(map[string][]string, len(s.Route))
+	for t, each := range s.Route {
+		if _, ok := choices[t]; !ok {
+			newRoute[t] = each
+		}
+	}
+	for t, each := range route {
+		newRoute[t] = each
+	}
+	moves := make([]Move, 0, len(s.Move))
+	for _, m := range s.Move {
+		if _, ok := choices[m.Train]; !ok {
+			moves = append(moves, m)
+		}
+	}
+	s.Route = newRoute
+	s.Move = append(moves, planned...)
+	sortMoves(s.Move)
+	return nil
+}
+
+// Copy the state so that it can be changed without touching s.
+// Router, Train and Package are problem data which is never modified, so they are shared. Route, Move and Deferred
+// are replaced as a whole whenever they change.
+func (s State) clone() State {
+	newState := s
+	newState.TrainAssignment = make(map[string][]string, len(s.TrainAssignment))
+	for t, pkgs := range s.TrainAssignment {
+		newState.TrainAssignment[t] = append(make([]string, 0, len(pkgs)), pkgs...)
+	}
+	return newState
+}
+
+// Clone deep copies the state so that it can be handed to another goroutine.
+// The graph is only ever read, so it stays shared.
+func (s State) Clone() anneal.State {
+	newState := s.clone()
+	newState.Route = make(map[string][]string, len(s.Route))
+	for t, route := range s.Route {
+		newState.Route[t] = append(make([]string, 0, len(route)), route...)
+	}
+	newState.Deferred = make(map[string]bool, len(s.Deferred))
+	for p, deferred := range s.Deferred {
+		newState.Deferred[p] = deferred
+	}
+	newState.Move = make([]Move, len(s.Move))
+	for i, m := range s.Move {
+		m.PickedPackage = append(make([]string, 0, len(m.PickedPackage)), m.PickedPackage...)
+		m.DroppedPackage = append(make([]string, 0, len(m.DroppedPackage)), m.DroppedPackage...)
+		newState.Move[i] = m
+	}
+	newState.Train = make(map[string]*types.Train, len(s.Train))
+	for name, t := range s.Train {
+		train := *t
+		newState.Train[name] = &train
+	}
+	newState.Package = make(map[string]*types.Package, len(s.Package))
+	for name, p := range s.Package {
+		pkg := *p
+		newState.Package[name] = &pkg
+	}
+	return newState
+}
 
-	path := make([]string, 0)
-	temp := end
-	for temp != "" {
-		path = append([]string{temp}, path...)
-		temp = prev[temp]
+// Total weight of the packages assigned to the train
+func (s State) load(train string) int {
+	weight := 0
+	for _, p := range s.TrainAssignment[train] {
+		weight += s.Package[p].Weight
 	}
-	return duration[end], path
+	return weight
+}
+
+// Get random train
+func (s State) getRandomTrain(r *rand.Rand) string {
+	trainName := sortedKeys(s.Train)
+	tName := trainName[r.Intn(len(trainName))]
+	return tName
 }
 
 // Randomly travel the nodes using DFS
-func randomGraphTravel(graph types.Graph, start, end string) []string {
-	visited := make(map[string]bool)
-	stack := [][]string{{start}}
+func randomGraphTravel(network *types.Network, start, end int, r *rand.Rand) []int {
+	visited := make([]bool, network.Len())
+	stack := [][]int{{start}}
 
 	for len(stack) > 0 {
 		path := stack[len(stack)-1]
@@ -188,19 +527,17 @@ func randomGraphTravel(graph types.Graph, start, end string) []string {
 		if !visited[curr] {
 			visited[curr] = true
 
-			neighbor := make([]string, 0)
-			for each := range graph[curr] {
-				neighbor = append(neighbor, each)
-			}
+			targets, _ := network.Neighbours(curr)
+			neighbor := append(make([]int, 0, len(targets)), targets...)
 			// Shuffle the neighbour sequence for the randomness
 			if len(neighbor) > 0 {
-				rand.Shuffle(len(neighbor), func(i, j int) {
+				r.Shuffle(len(neighbor), func(i, j int) {
 					neighbor[i], neighbor[j] = neighbor[j], neighbor[i]
 				})
 
 				for _, n := range neighbor {
 					if !visited[n] {
-						newPath := make([]string, len(path))
+						newPath := make([]int, len(path))
 						copy(newPath, path)
 						newPath = append(newPath, n)
 						stack = append(stack, newPath)
@@ -213,23 +550,14 @@ func randomGraphTravel(graph types.Graph, start, end string) []string {
 	return nil
 }
 
-// Get random neighbor node
-func getRandomNeighborNode(graph types.Graph, currNode string) string {
-	neighbor := make([]string, 0, len(graph[currNode]))
-	for n := range graph[currNode] {
-		neighbor = append(neighbor, n)
-	}
-	nName := neighbor[rand.Intn(len(neighbor))]
-	return nName
-}
+// Number of packages assignPkgToTrain puts on a train while searching for an assignment, before it falls back to
+// first fit
+const assignBudget = 100000
 
-// Package assignment
-func assignPkgToTrain(graph types.Graph, train map[string]*types.Train, pkg map[string]*types.Package) map[string][]string {
-	trainKey := make([]string, 0, len(train))
+// Package assignment, every package goes on a train which is able to reach it
+func assignPkgToTrain(router Router, train map[string]*types.Train, pkg map[string]*types.Package, r *rand.Rand) (map[string][]string, error) {
 	// Generate key
-	for _, each := range train {
-		trainKey = append(trainKey, each.Name)
-	}
+	trainKey := sortedKeys(train)
 
 	trainAssgn := make(map[string][]string)
 	for _, each := range train {
@@ -241,137 +569,277 @@ func assignPkgToTrain(graph types.Graph, train map[string]*types.Train, pkg map[
 		sortedPkg = append(sortedPkg, each)
 	}
 	sort.Slice(sortedPkg, func(x, y int) bool {
-		return sortedPkg[x].Weight > sortedPkg[y].Weight
+		if sortedPkg[x].Weight != sortedPkg[y].Weight {
+			return sortedPkg[x].Weight > sortedPkg[y].Weight
+		}
+		return sortedPkg[x].Name < sortedPkg[y].Name
 	})
 
+	// Capacity left on each train
+	capacity := make(map[string]int)
+	for _, each := range train {
+		capacity[each.Name] = each.Capacity
+	}
+	for _, p := range sortedPkg {
+		fits := false
+		for _, k := range trainKey {
+			fits = fits || (train[k].Capacity >= p.Weight && router.reaches(train[k], p))
+		}
+		if !fits {
+			return nil, fmt.Errorf("no train which reaches package %s is able to carry its weight %d", p.Name, p.Weight)
+		}
+	}
+
+	// Put every package on a random train with enough capacity left, and go back to an earlier package when none has.
+	// The search gives up after assignBudget packages put on a train.
+	steps := 0
+	var assign func(i int) bool
+	assign = func(i int) bool {
+		if i == len(sortedPkg) {
+			return true
+		}
+		if steps >= assignBudget {
+			return false
+		}
+		steps++
+		p := sortedPkg[i]
+		candidate := make([]string, 0, len(trainKey))
+		for _, k := range trainKey {
+			if capacity[k] >= p.Weight && router.reaches(train[k], p) {
+				candidate = append(candidate, k)
+			}
+		}
+		if len(candidate) == 0 {
+			return false
+		}
+
+		first := r.Intn(len(candidate))
+		// Trains with the same capacity left lead to the same packages fitting, so only one of them is tried
+		tried := make(map[int]bool)
+		for c := range candidate {
+			t := candidate[(first+c)%len(candidate)]
+			if tried[capacity[t]] {
+				continue
+			}
+			tried[capacity[t]] = true
+			trainAssgn[t] = append(trainAssgn[t], p.Name)
+			capacity[t] -= p.Weight
+			if assign(i + 1) {
+				return true
+			}
+			trainAssgn[t] = trainAssgn[t][:len(trainAssgn[t])-1]
+			capacity[t] += p.Weight
+		}
+		return false
+	}
+	if assign(0) {
+		return trainAssgn, nil
+	}
+	if steps < assignBudget {
+		return nil, errors.New("the packages do not fit on the trains")
+	}
+
+	// Out of budget, put the heaviest package first on the first train with enough capacity left
+	for _, k := range trainKey {
+		trainAssgn[k] = []string{}
+		capacity[k] = train[k].Capacity
+	}
 	for _, p := range sortedPkg {
-		for {
-			randTrainKey := trainKey[rand.Intn(len(train))]
-			// Check the capacity
-			t := train[randTrainKey]
-			if t.CurrentCapacity >= p.Weight {
-				trainAssgn[t.Name] = append(trainAssgn[t.Name], p.Name)
-				t.CurrentCapacity -= p.Weight
+		fits := false
+		for _, k := range trainKey {
+			if capacity[k] >= p.Weight && router.reaches(train[k], p) {
+				trainAssgn[k] = append(trainAssgn[k], p.Name)
+				capacity[k] -= p.Weight
+				fits = true
 				break
 			}
 		}
+		if !fits {
+			return nil, fmt.Errorf("no assignment of the packages to the trains found within %d steps, package %s does not fit on the trains by first fit", assignBudget, p.Name)
+		}
 	}
-	return trainAssgn
+	return trainAssgn, nil
 }
 
 // Create route for train to deliver assigned package
-func planRoute(graph types.Graph, assignment map[string][]string, train map[string]*types.Train, pkg map[string]*types.Package) (map[string][]string, []Move) {
+// Every train runs on its own clock starting at 0, the moves of all trains are merged and sorted by time.
+// The train data and the package index of the router are only read, so the same problem can be shared by many states.
+// The stations and packages are handled by their number, and named again in the route and the moves.
+// Every leg follows the routing policy of the router. It fails when a train cannot reach one of its stops.
+// After picking up a package the train delivers every package on board, unless all of them are deferred. It then
+// goes on to pick up the next package of its sequence first.
+func planRoute(router Router, assignment map[string][]string, deferred map[string]bool, train map[string]*types.Train, r *rand.Rand) (map[string][]string, []Move, error) {
+	return planLegs(router, assignment, deferred, train, nil, r)
+}
+
+// Same as planRoute, but a leg of train t from station a to station b follows path choices[t][[2]int{a, b}] of the
+// router. The trains of choices take the first path between stations they have no choice for, the other trains a
+// random one. A train takes the same path whenever it joins the same two stations again.
+func planLegs(router Router, assignment map[string][]string, deferred map[string]bool, train map[string]*types.Train, choices map[string]map[[2]int]int, r *rand.Rand) (map[string][]string, []Move, error) {
+	network := router.Network
+	packages := router.Packages
 	route := make(map[string][]string)
-	nodeToPkgMap := make(map[string][]string)
 	move := make([]Move, 0)
-	timeTaken := 0
-
-	for _, each := range pkg {
-		if _, ok := nodeToPkgMap[each.StartAt]; !ok {
-			nodeToPkgMap[each.StartAt] = []string{}
+	picked := make([]bool, len(packages.Names))
+
+	// Go through the trains in a fixed order so that the random choices are reproducible
+	for _, t := range sortedKeys(assignment) {
+		pkgs := make([]int, len(assignment[t]))
+		assigned := make([]bool, len(packages.Names))
+		for i, name := range assignment[t] {
+			pkgs[i] = packages.Number[name]
+			assigned[pkgs[i]] = true
 		}
-		nodeToPkgMap[each.StartAt] = append(nodeToPkgMap[each.StartAt], each.Name)
-	}
-
-	for t, pkgs := range assignment {
+		timeTaken := 0
+		location, _ := network.ID(train[t].StartAt)
+		// Packages picked up at the current node, they are loaded when the train departs
+		loaded := make([]string, 0)
 		// pickedUp stack to use as stack of delivery job
-		train[t].PickedPackage = make([]string, 0)
-		train[t].DroppedPackage = make([]string, 0)
-
-		// The pkg loop here basically generate route for picking up a pkg and drop the package one at a time
-		for _, name := range pkgs {
-			// Skip if package had been picked up by previous route where the train might passed through the node.
-			if pkg[name].Picked {
-				continue
+		pickedUp := make([]int, 0)
+
+		// Drop off the picked up packages destined to the node, and pick up the packages of the train waiting there
+		visit := func(node int) []string {
+			dropped := make([]string, 0)
+			for j := len(pickedUp) - 1; j >= 0; j-- {
+				if packages.Destination[pickedUp[j]] == node {
+					// Remove from the pickup queue, we don't have to deliver later, as we can drop off now
+					dropped = append(dropped, packages.Names[pickedUp[j]])
+					pickedUp = append(pickedUp[:j], pickedUp[j+1:]...)
+				}
 			}
 
-			pickUpPath := randomGraphTravel(graph, train[t].CurrentLocation, pkg[name].StartAt)
+			// Check if the path passing thru some other package that assigned to the train, might as well pick up.
+			for _, each := range packages.Waiting[node] {
+				if assigned[each] && !picked[each] {
+					picked[each] = true
+					pickedUp = append(pickedUp, each)
+					loaded = append(loaded, packages.Names[each])
+				}
+			}
+			return dropped
+		}
 
-			// Pickup
-			for i := 0; i < len(pickUpPath)-1; i++ {
+		// Path the train follows between every two stations, it takes the same path whenever it joins them again
+		followed := make(map[[2]int]int)
+		for stops, choice := range choices[t] {
+			followed[stops] = choice
+		}
+		_, fixed := choices[t]
+
+		// Move the train along the next leg
+		leg := 0
+		travel := func(end int) error {
+			stops := [2]int{location, end}
+			choice, ok := followed[stops]
+			if !ok && !fixed {
+				choice = -1
+			}
+			path, choice := router.leg(location, end, choice, r)
+			if path == nil {
+				return fmt.Errorf("train %s cannot reach %s from %s", t, network.Name(end), network.Name(location))
+			}
+			followed[stops] = choice
+			for i := 0; i < len(path)-1; i++ {
+				weight, _ := network.Weight(path[i], path[i+1])
 				m := Move{
-					TimeTaken:      timeTaken,
-					Train:          train[t].Name,
-					StartNode:      pickUpPath[i],
-					EndNode:        pickUpPath[i+1],
-					PickedPackage:  train[t].PickedPackage,
-					DroppedPackage: train[t].DroppedPackage,
+					Start:         timeTaken,
+					End:           timeTaken + weight,
+					Train:         train[t].Name,
+					StartNode:     network.Name(path[i]),
+					EndNode:       network.Name(path[i+1]),
+					PickedPackage: loaded,
+					Leg:           leg,
+					Path:          choice,
 				}
+				loaded = make([]string, 0)
+				timeTaken = m.End
+				m.DroppedPackage = visit(path[i+1])
 				move = append(move, m)
-				timeTaken += graph[pickUpPath[i]][pickUpPath[i+1]]
-
-				// Check if the path passing thru some other package that assigned to the train, might as well pick up.
-				pkgEncounterInThePath := commonStrings(pkgs, nodeToPkgMap[pickUpPath[i+1]])
-				for _, each := range pkgEncounterInThePath {
-					if !pkg[each].Picked {
-						pkg[each].Picked = true
-						train[t].PickedPackage = append(train[t].PickedPackage, each)
-					}
-				}
 			}
+			for _, node := range path {
+				route[t] = append(route[t], network.Name(node))
+			}
+			leg++
+			return nil
+		}
 
-			route[t] = append(route[t], pickUpPath...)
-			// Update train current location to picked up package location
-			train[t].CurrentLocation = pkg[name].StartAt
-
-			// Drop off the packages
-			for len(train[t].PickedPackage) > 0 {
-				p := train[t].PickedPackage[len(train[t].PickedPackage)-1]
-				dropOffPath := randomGraphTravel(graph, train[t].CurrentLocation, pkg[p].Destination)
-
-				for i := 0; i < len(dropOffPath)-1; i++ {
-					m := Move{
-						TimeTaken:      timeTaken,
-						Train:          train[t].Name,
-						StartNode:      dropOffPath[i],
-						EndNode:        dropOffPath[i+1],
-						PickedPackage:  train[t].PickedPackage,
-						DroppedPackage: train[t].DroppedPackage,
-					}
-					move = append(move, m)
-					timeTaken += graph[dropOffPath[i]][dropOffPath[i+1]]
-
-					// Check if the path passing thru some other package that assigned to the train, might as well pick up.
-					pkgEncounterInThePath := commonStrings(pkgs, nodeToPkgMap[dropOffPath[i+1]])
-					for _, each := range pkgEncounterInThePath {
-						if !pkg[each].Picked {
-							pkg[each].Picked = true
-							train[t].PickedPackage = append(train[t].PickedPackage, each)
-						}
-					}
-
-					// Check if passing thru some node which is destination of some picked up package
-					for j := len(train[t].PickedPackage) - 1; j >= 0; j-- {
-						if pkg[train[t].PickedPackage[j]].Destination == dropOffPath[i+1] {
-							// Remove from the pickup queue, we don't have to deliver later, as we can drop off now
-							train[t].CurrentCapacity += pkg[train[t].PickedPackage[j]].Weight
-							train[t].DroppedPackage = append(train[t].DroppedPackage, train[t].PickedPackage[j])
-							train[t].PickedPackage = append(train[t].PickedPackage[:j], train[t].PickedPackage[j+1:]...)
-						}
-					}
+		// Whether every package on board is deferred, the train then picks up the next package before delivering
+		wait := func() bool {
+			for _, p := range pickedUp {
+				if !deferred[packages.Names[p]] {
+					return false
 				}
+			}
+			return true
+		}
 
+		// Drop off the picked up packages
+		deliver := func() error {
+			for len(pickedUp) > 0 {
+				p := pickedUp[len(pickedUp)-1]
+				if err := travel(packages.Destination[p]); err != nil {
+					return err
+				}
 				// Update train current location to picked up destination
-				route[t] = append(route[t], dropOffPath...)
-				train[t].CurrentLocation = pkg[p].Destination
-				train[t].CurrentCapacity += pkg[p].Weight
+				location = packages.Destination[p]
+			}
+			return nil
+		}
+
+		// Packages waiting at the start station are picked up before the train leaves, and delivered first
+		visit(location)
+		if !wait() {
+			if err := deliver(); err != nil {
+				return nil, nil, err
 			}
 		}
-	}
-	return route, move
-}
 
-func commonStrings(arr1, arr2 []string) []string {
-	stringMap := make(map[string]bool)
-	for _, s := range arr1 {
-		stringMap[s] = true
+		// The pkg loop here basically generate route for picking up a pkg and drop the package one at a time
+		for _, p := range pkgs {
+			// Skip if package had been picked up by previous route where the train might passed through the node.
+			if picked[p] {
+				continue
+			}
+
+			// Pickup
+			if err := travel(packages.StartAt[p]); err != nil {
+				return nil, nil, err
+			}
+			// Update train current location to picked up package location
+			location = packages.StartAt[p]
+			if wait() {
+				continue
+			}
+			if err := deliver(); err != nil {
+				return nil, nil, err
+			}
+		}
+		// Deferred packages still on board after the last pickup
+		if err := deliver(); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	commonStrings := make([]string, 0)
-	for _, s := range arr2 {
-		if stringMap[s] {
-			commonStrings = append(commonStrings, s)
+	sortMoves(move)
+	return route, move, nil
+}
+
+// Merge the timeline of every train
+func sortMoves(move []Move) {
+	sort.SliceStable(move, func(i, j int) bool {
+		if move[i].Start != move[j].Start {
+			return move[i].Start < move[j].Start
 		}
+		return move[i].Train < move[j].Train
+	})
+}
+
+// Keys of the map in sorted order, used wherever the iteration order affects the result
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-	return commonStrings
+	sort.Strings(keys)
+	return keys
 }
@@ -1,53 +1,740 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"solution2/alns"
 	"solution2/anneal"
+	"solution2/genetic"
+	"solution2/graph"
 	"solution2/loader"
+	"solution2/mip"
+	"solution2/tabu"
+	"solution2/types"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test1(t *testing.T) {
-	train, pkg, graph := loader.Initialize("test/test1.txt")
-	asgn := assignPkgToTrain(graph, train, pkg)
-	r, m := planRoute(graph, asgn, train, pkg)
+	problem, err := loader.Initialize("test/test1.txt")
+	require.NoError(t, err)
+	train, pkg := problem.Train, problem.Package
+	require.NoError(t, loader.Validate(problem))
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, KShortestPaths)
+	asgn, err := assignPkgToTrain(router, train, pkg, rng)
+	require.NoError(t, err)
+	r, m, err := planRoute(router, asgn, nil, train, rng)
+	require.NoError(t, err)
 
-	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Graph: graph, Train: train, Package: pkg}
+	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: train, Package: pkg}
 
-	s := anneal.Init(initialState, anneal.Config{Iteration: 10000, Temperature: 25000, AneallingFactor: 0.99})
-	assert.Equal(t, 70, int(s.Energy()))
+	res := anneal.Init(context.Background(), initialState, anneal.Config{Iteration: 10000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1})
+	assert.Equal(t, 70, int(res.Energy))
 }
 
 func Test2(t *testing.T) {
-	train, pkg, graph := loader.Initialize("test/test2.txt")
-	asgn := assignPkgToTrain(graph, train, pkg)
-	r, m := planRoute(graph, asgn, train, pkg)
+	problem, err := loader.Initialize("test/test2.txt")
+	require.NoError(t, err)
+	train, pkg := problem.Train, problem.Package
+	require.NoError(t, loader.Validate(problem))
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, KShortestPaths)
+	asgn, err := assignPkgToTrain(router, train, pkg, rng)
+	require.NoError(t, err)
+	r, m, err := planRoute(router, asgn, nil, train, rng)
+	require.NoError(t, err)
 
-	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Graph: graph, Train: train, Package: pkg}
+	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: train, Package: pkg}
 
-	s := anneal.Init(initialState, anneal.Config{Iteration: 10000, Temperature: 25000, AneallingFactor: 0.99})
-	assert.Equal(t, 40, int(s.Energy()))
+	res := anneal.Init(context.Background(), initialState, anneal.Config{Iteration: 10000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1})
+	assert.Equal(t, 40, int(res.Energy))
 }
 
 func Test3(t *testing.T) {
-	train, pkg, graph := loader.Initialize("test/test3.txt")
-	asgn := assignPkgToTrain(graph, train, pkg)
-	r, m := planRoute(graph, asgn, train, pkg)
+	problem, err := loader.Initialize("test/test3.txt")
+	require.NoError(t, err)
+	train, pkg := problem.Train, problem.Package
+	require.NoError(t, loader.Validate(problem))
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, KShortestPaths)
+	asgn, err := assignPkgToTrain(router, train, pkg, rng)
+	require.NoError(t, err)
+	r, m, err := planRoute(router, asgn, nil, train, rng)
+	require.NoError(t, err)
 
-	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Graph: graph, Train: train, Package: pkg}
+	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: train, Package: pkg}
 
-	s := anneal.Init(initialState, anneal.Config{Iteration: 10000, Temperature: 25000, AneallingFactor: 0.99})
-	assert.Equal(t, 26, int(s.Energy()))
+	res := anneal.Init(context.Background(), initialState, anneal.Config{Iteration: 10000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1})
+	assert.Equal(t, 26, int(res.Energy))
 }
 
 func Test4(t *testing.T) {
-	train, pkg, graph := loader.Initialize("test/test4.txt")
-	asgn := assignPkgToTrain(graph, train, pkg)
-	r, m := planRoute(graph, asgn, train, pkg)
+	problem, err := loader.Initialize("test/test4.txt")
+	require.NoError(t, err)
+	train, pkg := problem.Train, problem.Package
+	require.NoError(t, loader.Validate(problem))
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, KShortestPaths)
+	asgn, err := assignPkgToTrain(router, train, pkg, rng)
+	require.NoError(t, err)
+	r, m, err := planRoute(router, asgn, nil, train, rng)
+	require.NoError(t, err)
 
-	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Graph: graph, Train: train, Package: pkg}
+	initialState := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: train, Package: pkg}
 
-	s := anneal.Init(initialState, anneal.Config{Iteration: 10000, Temperature: 25000, AneallingFactor: 0.99})
-	assert.Equal(t, 25, int(s.Energy()))
+	res := anneal.Init(context.Background(), initialState, anneal.Config{Iteration: 10000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1})
+	assert.Equal(t, 25, int(res.Energy))
+}
+
+func TestObjective(t *testing.T) {
+	timeTaken := map[string]int{"Q1": 30, "Q2": 10}
+
+	assert.Equal(t, 40.0, Objective{Kind: TotalTime}.Evaluate(timeTaken))
+	assert.Equal(t, 30.0, Objective{Kind: Makespan}.Evaluate(timeTaken))
+	assert.Equal(t, 35.0, Objective{Kind: Weighted, MakespanWeight: 0.5}.Evaluate(timeTaken))
+
+	_, err := ParseObjective("fastest", 0)
+	assert.Error(t, err)
+}
+
+func TestPlanRouteTimeline(t *testing.T) {
+	problem, err := loader.Initialize("test/test2.txt")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, RandomPath)
+	asgn, err := assignPkgToTrain(router, problem.Train, problem.Package, rng)
+	require.NoError(t, err)
+	_, m, err := planRoute(router, asgn, nil, problem.Train, rng)
+	require.NoError(t, err)
+
+	// Every train starts at 0 and continues from where its previous move ended
+	clock := make(map[string]int)
+	for i, each := range m {
+		assert.Equal(t, clock[each.Train], each.Start)
+		assert.Equal(t, each.Start+problem.Graph[each.StartNode][each.EndNode], each.End)
+		clock[each.Train] = each.End
+		if i > 0 {
+			assert.LessOrEqual(t, m[i-1].Start, each.Start)
+		}
+	}
+}
+
+func TestPackageAtStartStation(t *testing.T) {
+	problem := parseProblem(t, "2\nA\nB\n\n1\nE1,A,B,10\n\n1\nK1,5,A,B\n\n1\nQ1,5,A\n")
+	asgn := map[string][]string{"Q1": {"K1"}}
+
+	// The package waiting where the train starts is taken along and delivered, whatever the routing
+	for _, policy := range []RoutingPolicy{ShortestPath, KShortestPaths, RandomPath} {
+		router := newRouter(problem, policy)
+		r, m, err := planRoute(router, asgn, nil, problem.Train, rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+		s := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: problem.Train, Package: problem.Package}
+		assert.Equal(t, []Move{{Start: 0, End: 10, Train: "Q1", StartNode: "A", EndNode: "B", PickedPackage: []string{"K1"}, DroppedPackage: []string{"K1"}}}, m)
+		assert.Equal(t, 10.0, s.Energy())
+		assert.NoError(t, checkPlan(s))
+	}
+}
+
+// Parse and validate a problem written out in the test
+func parseProblem(t *testing.T, input string) types.Problem {
+	problem, err := loader.Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.NoError(t, loader.Validate(problem))
+	return problem
+}
+
+// Problem whose packages only fit on the trains with K1 and K2 on Q1. Putting either of them on a random train
+// often overloads the other train, so the assignment has to be taken back or repaired.
+func tightProblem(t *testing.T) types.Problem {
+	return parseProblem(t, "2\nA\nB\n\n1\nE1,A,B,10\n\n4\nK1,3,A,B\nK2,3,A,B\nK3,2,A,B\nK4,2,A,B\n\n2\nQ1,6,A\nQ2,4,A\n")
+}
+
+func TestDeferredDelivery(t *testing.T) {
+	problem, err := loader.Initialize("test/test3.txt")
+	require.NoError(t, err)
+	router := newRouter(problem, ShortestPath)
+	asgn := map[string][]string{"Q1": {"K1", "K2", "K3"}}
+
+	// Delivered right after every pickup, K1 goes to C first
+	r, _, err := planRoute(router, asgn, nil, problem.Train, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "C"}, r["Q1"][:2])
+
+	// K1 and K2 stay on board until K3 is picked up, then all three are dropped off on the way from D to C
+	deferred := map[string]bool{"K1": true, "K2": true}
+	r, m, err := planRoute(router, asgn, deferred, problem.Train, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	s := State{TrainAssignment: asgn, Route: r, Move: m, Deferred: deferred, Router: router, Train: problem.Train, Package: problem.Package}
+	assert.Equal(t, []string{"A", "B", "B", "D", "D", "E", "C"}, r["Q1"])
+	assert.Equal(t, 26.0, s.Energy())
+	assert.NoError(t, checkPlan(s))
+}
+
+func TestAssignmentFitsCapacity(t *testing.T) {
+	// The total weight fits on the trains, but there is no way to split the packages between them
+	problem := parseProblem(t, "2\nA\nB\n\n1\nE1,A,B,10\n\n3\nK1,4,A,B\nK2,4,A,B\nK3,2,A,B\n\n2\nQ1,5,A\nQ2,5,A\n")
+	_, err := assignPkgToTrain(newRouter(problem, ShortestPath), problem.Train, problem.Package, rand.New(rand.NewSource(1)))
+	assert.Error(t, err)
+
+	problem = tightProblem(t)
+	for seed := int64(0); seed < 20; seed++ {
+		asgn, err := assignPkgToTrain(newRouter(problem, ShortestPath), problem.Train, problem.Package, rand.New(rand.NewSource(seed)))
+		require.NoError(t, err)
+		for name, pkgs := range asgn {
+			weight := 0
+			for _, p := range pkgs {
+				weight += problem.Package[p].Weight
+			}
+			assert.LessOrEqual(t, weight, problem.Train[name].Capacity, "%v", asgn)
+		}
+	}
+
+	// 40 packages are one too many for the trains, the search gives up instead of trying every assignment
+	var input strings.Builder
+	input.WriteString("2\nA\nB\n\n1\nE1,A,B,10\n\n40\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&input, "K%d,3,A,B\n", i)
+	}
+	input.WriteString("\n2\nQ1,60,A\nQ2,59,A\n")
+	problem, err = loader.Parse(strings.NewReader(input.String()))
+	require.NoError(t, err)
+	assert.ErrorContains(t, loader.Validate(problem), "total weight 120 exceeds the total capacity 119")
+	_, err = assignPkgToTrain(newRouter(problem, ShortestPath), problem.Train, problem.Package, rand.New(rand.NewSource(1)))
+	assert.Error(t, err)
+}
+
+func TestUnreachableTrain(t *testing.T) {
+	// Q2 is able to carry K1 but runs on another part of the network
+	problem := parseProblem(t, "4\nA\nB\nC\nD\n\n2\nE1,A,B,10\nE2,C,D,10\n\n1\nK1,5,A,B\n\n2\nQ1,5,A\nQ2,5,C\n")
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, ShortestPath)
+
+	_, _, err := planRoute(router, map[string][]string{"Q1": {}, "Q2": {"K1"}}, nil, problem.Train, rng)
+	assert.ErrorContains(t, err, "train Q2 cannot reach A from C")
+
+	s, err := newState(problem, Objective{}, router, rng)
+	require.NoError(t, err)
+	destroy, repair := alnsOperators(router.Paths)
+	for i := 0; i < 50; i++ {
+		for _, next := range []anneal.State{s.Neighbor(rng), s.Mutate(rng), s.Crossover(s, rng), repair[0].Apply(destroy[0].Apply(s, rng), rng)} {
+			assert.Equal(t, []string{"K1"}, next.(State).TrainAssignment["Q1"])
+			assert.NoError(t, checkPlan(next.(State)))
+		}
+	}
+	res := anneal.Init(context.Background(), s, anneal.Config{Iteration: 200, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1})
+	assert.Equal(t, 10, int(res.Energy))
+}
+
+func TestNeighborKeepsState(t *testing.T) {
+	problem, err := loader.Initialize("test/test4.txt")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, KShortestPaths)
+	asgn, err := assignPkgToTrain(router, problem.Train, problem.Package, rng)
+	require.NoError(t, err)
+	r, m, err := planRoute(router, asgn, nil, problem.Train, rng)
+	require.NoError(t, err)
+	s := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: problem.Train, Package: problem.Package}
+
+	before := s.clone()
+	energy := s.Energy()
+	for i := 0; i < 1000; i++ {
+		s.Neighbor(rng)
+	}
+	assert.Equal(t, before.TrainAssignment, s.TrainAssignment)
+	assert.Equal(t, energy, s.Energy())
+}
+
+func TestSeededRunIsReproducible(t *testing.T) {
+	problem, err := loader.Initialize("test/test3.txt")
+	require.NoError(t, err)
+
+	run := func(seed int64) State {
+		rng := rand.New(rand.NewSource(seed))
+		router := newRouter(problem, KShortestPaths)
+		asgn, err := assignPkgToTrain(router, problem.Train, problem.Package, rng)
+		require.NoError(t, err)
+		r, m, err := planRoute(router, asgn, nil, problem.Train, rng)
+		require.NoError(t, err)
+		initialState := State{TrainAssignment: asgn, Route: r, Move: m, Router: router, Train: problem.Train, Package: problem.Package}
+		return anneal.Init(context.Background(), initialState, anneal.Config{Iteration: 1000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: seed}).State.(State)
+	}
+
+	first, second := run(42), run(42)
+	assert.Equal(t, first.Move, second.Move)
+	assert.Equal(t, first.TrainAssignment, second.TrainAssignment)
+}
+
+func TestParallel(t *testing.T) {
+	problem, err := loader.Initialize("test/test3.txt")
+	require.NoError(t, err)
+	initialState, err := newState(problem, Objective{}, newRouter(problem, KShortestPaths), rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+
+	conf := anneal.Config{Iteration: 2000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1}
+	res := anneal.Parallel(context.Background(), initialState, conf, anneal.ParallelConfig{Chains: 4, ShareEvery: 200})
+	assert.Equal(t, 26, int(res.Energy))
+}
+
+// Optimal total time of the test problems, proven by the exact solver
+var optimum = map[string]int{"test/test1.txt": 70, "test/test2.txt": 40, "test/test3.txt": 26, "test/test4.txt": 25}
+
+// Solve every test problem and check that the optimal plan is found
+func testSolver(t *testing.T, solve func(problem types.Problem, path string) anneal.Result) {
+	for _, path := range sortedKeys(optimum) {
+		problem, err := loader.Initialize(path)
+		require.NoError(t, err)
+		res := solve(problem, path)
+		assert.Equal(t, optimum[path], int(res.Energy), path)
+	}
+}
+
+func TestDefaultRouting(t *testing.T) {
+	policy, err := ParseRoutingPolicy(defaultRouting)
+	require.NoError(t, err)
+
+	// Deferred deliveries let the trains pick up several packages along the shortest paths before delivering them
+	testSolver(t, func(problem types.Problem, path string) anneal.Result {
+		initialState, err := newState(problem, Objective{}, newRouter(problem, policy), rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+		return anneal.Init(context.Background(), initialState, anneal.Config{Iteration: 10000, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1})
+	})
+	testSolver(t, func(problem types.Problem, path string) anneal.Result {
+		initialState, err := newState(problem, Objective{}, newRouter(problem, policy), rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+		return tabu.Search(context.Background(), initialState, tabu.Config{Iteration: 500, Seed: 1})
+	})
+}
+
+func TestTabuSearch(t *testing.T) {
+	testSolver(t, func(problem types.Problem, path string) anneal.Result {
+		initialState, err := newState(problem, Objective{}, newRouter(problem, KShortestPaths), rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+		return tabu.Search(context.Background(), initialState, tabu.Config{Iteration: 500, Seed: 1})
+	})
+}
+
+func TestGenetic(t *testing.T) {
+	testSolver(t, func(problem types.Problem, path string) anneal.Result {
+		fresh := func(r *rand.Rand) genetic.Individual {
+			s, err := newState(problem, Objective{}, newRouter(problem, KShortestPaths), r)
+			assert.NoError(t, err)
+			return s
+		}
+		res := genetic.Evolve(context.Background(), fresh, genetic.Config{Population: 30, Generations: 50, Seed: 1})
+
+		// Children never carry more than the capacity of a train when the packages fit elsewhere
+		best := res.State.(State)
+		for name, train := range best.Train {
+			assert.LessOrEqual(t, best.load(name), train.Capacity, path)
+		}
+		return res
+	})
+}
+
+func TestChildrenFitCapacity(t *testing.T) {
+	// Many children overload a train beyond repair
+	problem := tightProblem(t)
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, ShortestPath)
+	fits := func(s State) {
+		for name, each := range s.Train {
+			assert.LessOrEqual(t, s.load(name), each.Capacity, "%v", s.TrainAssignment)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		a, err := newState(problem, Objective{}, router, rng)
+		require.NoError(t, err)
+		b, err := newState(problem, Objective{}, router, rng)
+		require.NoError(t, err)
+		fits(a.Crossover(b, rng).(State))
+		fits(a.Mutate(rng).(State))
+	}
+}
+
+func TestALNS(t *testing.T) {
+	testSolver(t, func(problem types.Problem, path string) anneal.Result {
+		initialState, err := newState(problem, Objective{}, newRouter(problem, KShortestPaths), rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+
+		destroy, repair := alnsOperators(graph.New(problem.Graph))
+		conf := alns.Config{Config: anneal.Config{Iteration: 500, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1}, Destroy: destroy, Repair: repair}
+		res := alns.Search(context.Background(), initialState, conf)
+		assert.Equal(t, uint(500), res.Stats.Accepted+res.Stats.Rejected, path)
+		return res
+	})
+}
+
+func TestRepairInsertsEveryPackage(t *testing.T) {
+	problem, err := loader.Initialize("test/test4.txt")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	s, err := newState(problem, Objective{}, newRouter(problem, KShortestPaths), rng)
+	require.NoError(t, err)
+
+	destroy, repair := alnsOperators(graph.New(problem.Graph))
+	for _, d := range destroy {
+		for _, p := range repair {
+			repaired := p.Apply(d.Apply(s, rng), rng).(State)
+			assigned := make([]string, 0)
+			for _, sequence := range repaired.TrainAssignment {
+				assigned = append(assigned, sequence...)
+			}
+			assert.ElementsMatch(t, sortedKeys(problem.Package), assigned, d.Name+" "+p.Name)
+		}
+	}
+}
+
+func TestRepairFitsCapacity(t *testing.T) {
+	// Many repairs cannot put every package back
+	problem := tightProblem(t)
+	rng := rand.New(rand.NewSource(1))
+	s, err := newState(problem, Objective{}, newRouter(problem, ShortestPath), rng)
+	require.NoError(t, err)
+
+	failed := 0
+	destroy, repair := alnsOperators(graph.New(problem.Graph))
+	for i := 0; i < 20; i++ {
+		for _, d := range destroy {
+			for _, p := range repair {
+				repaired := p.Apply(d.Apply(s, rng), rng)
+				if repaired == nil {
+					failed++
+					continue
+				}
+				for name, each := range problem.Train {
+					assert.LessOrEqual(t, repaired.(State).load(name), each.Capacity, d.Name+" "+p.Name)
+				}
+			}
+		}
+	}
+	assert.NotZero(t, failed)
+
+	res := alns.Search(context.Background(), s, alns.Config{Config: anneal.Config{Iteration: 200, InitialAcceptance: 0.8, FinalTemperature: 0.1, Seed: 1}, Destroy: destroy, Repair: repair})
+	for name, each := range problem.Train {
+		assert.LessOrEqual(t, res.State.(State).load(name), each.Capacity)
+	}
+}
+
+func TestExact(t *testing.T) {
+	testSolver(t, func(problem types.Problem, path string) anneal.Result {
+		optimal, err := solveExact(problem, Objective{})
+		require.NoError(t, err)
+
+		// Every package is picked up at its station and dropped off at its destination by the train carrying it
+		carrier := make(map[string]string)
+		for _, m := range optimal.Move {
+			for _, p := range m.PickedPackage {
+				assert.Equal(t, problem.Package[p].StartAt, m.StartNode, path)
+				carrier[p] = m.Train
+			}
+			for _, p := range m.DroppedPackage {
+				assert.Equal(t, problem.Package[p].Destination, m.EndNode, path)
+				assert.Equal(t, carrier[p], m.Train, path)
+				delete(carrier, p)
+			}
+		}
+		assert.Empty(t, carrier, path)
+		return anneal.Result{State: optimal, Energy: optimal.Energy()}
+	})
+
+	// Under the makespan the two trains of test2 share the work
+	problem, err := loader.Initialize("test/test2.txt")
+	require.NoError(t, err)
+	optimal, err := solveExact(problem, Objective{Kind: Makespan})
+	require.NoError(t, err)
+	assert.Equal(t, 25, int(optimal.Energy()))
+}
+
+func TestLowerBound(t *testing.T) {
+	expected := map[string]int{"test/test1.txt": 70, "test/test2.txt": 25, "test/test3.txt": 26, "test/test4.txt": 24}
+	for path, bound := range expected {
+		problem, err := loader.Initialize(path)
+		require.NoError(t, err)
+		assert.Equal(t, bound, int(lowerBound(problem, graph.New(problem.Graph))), path)
+
+		// The bound never goes above the optimum of any objective
+		for _, objective := range []Objective{{Kind: TotalTime}, {Kind: Makespan}, {Kind: Weighted, MakespanWeight: 0.5}} {
+			optimal, err := solveExact(problem, objective)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, float64(bound), optimal.Energy(), path)
+		}
+	}
+
+	assert.Equal(t, 0.0, gap(25, 25))
+	assert.InDelta(t, 0.6, gap(40, 25), 1e-9)
+	assert.True(t, math.IsInf(gap(10, 0), 1))
+}
+
+func TestExportModel(t *testing.T) {
+	// The optimal plan is a solution of the model with the same objective value
+	for _, path := range []string{"test/test1.txt", "test/test2.txt", "test/test3.txt", "test/test4.txt"} {
+		problem, err := loader.Initialize(path)
+		require.NoError(t, err)
+		optimal, err := solveExact(problem, Objective{})
+		require.NoError(t, err)
+		paths := graph.New(problem.Graph)
+		model := mip.Build(problem, paths.Distance, 0)
+
+		index := make(map[string]int)
+		for i, p := range sortedKeys(problem.Package) {
+			index[p] = i
+		}
+		values := make(map[string]float64)
+		for k, train := range sortedKeys(problem.Train) {
+			// Visit the nodes in the order of the moves, from the start to the end of the route
+			label, station, time := "s", problem.Train[train].StartAt, 0
+			visit := func(next, at string) {
+				if next != "e" {
+					time += paths.Distance(station, at) + 1
+					values[fmt.Sprintf("t_%d_%s", k, next)] = float64(time)
+				}
+				values[fmt.Sprintf("x_%d_%s_%s", k, label, next)] = 1
+				label, station = next, at
+			}
+			for _, m := range optimal.Move {
+				if m.Train != train {
+					continue
+				}
+				for _, p := range m.PickedPackage {
+					values[fmt.Sprintf("y_%d_%d", k, index[p])] = 1
+					visit(fmt.Sprintf("p%d", index[p]), m.StartNode)
+				}
+				for _, p := range m.DroppedPackage {
+					visit(fmt.Sprintf("d%d", index[p]), m.EndNode)
+				}
+			}
+			values[fmt.Sprintf("t_%d_e", k)] = float64(time + 1)
+			visit("e", station)
+		}
+
+		sum := func(terms []mip.Term) float64 {
+			var total float64
+			for _, term := range terms {
+				total += term.Coef * values[term.Var]
+			}
+			return total
+		}
+		values["makespan"] = optimal.Energy()
+		for _, c := range model.Constraints {
+			switch c.Sense {
+			case mip.Equal:
+				assert.Equal(t, c.RHS, sum(c.Terms), "%s %s", path, c.Name)
+			case mip.LessOrEqual:
+				assert.LessOrEqual(t, sum(c.Terms), c.RHS, "%s %s", path, c.Name)
+			case mip.GreaterOrEqual:
+				assert.GreaterOrEqual(t, sum(c.Terms), c.RHS, "%s %s", path, c.Name)
+			}
+		}
+		assert.Equal(t, optimal.Energy(), sum(model.Objective), path)
+	}
+
+	dir := t.TempDir()
+	problem, err := loader.Initialize("test/test1.txt")
+	require.NoError(t, err)
+	assert.NoError(t, exportModel(filepath.Join(dir, "test1.lp"), problem, Objective{}))
+	assert.NoError(t, exportModel(filepath.Join(dir, "test1.mps"), problem, Objective{Kind: Makespan}))
+	assert.Error(t, exportModel(filepath.Join(dir, "test1.txt"), problem, Objective{}))
+}
+
+func TestImportPlan(t *testing.T) {
+	problem, err := loader.Initialize("test/test1.txt")
+	require.NoError(t, err)
+
+	// A schedule as printed by PrintMovement, with or without the comma before P2
+	schedule := `W=0, T=Q1, N1=B, P1=[], N2=A P2=[]
+W=30, T=Q1, N1=A, P1=[K1], N2=B, P2=[]
+W=60, T=Q1, N1=B, P1=[], N2=C P2=[K1]
+// Takes 70 mintues total.`
+	s, err := parseMovement(strings.NewReader(schedule), problem, Objective{})
+	require.NoError(t, err)
+	assert.Equal(t, 70.0, s.Energy())
+	assert.Equal(t, []string{"B", "A", "B", "C"}, s.Route["Q1"])
+
+	// Waiting at a station counts towards the time of the plan
+	waiting := `W=0, T=Q1, N1=B, P1=[], N2=A P2=[]
+W=45, T=Q1, N1=A, P1=[K1], N2=B, P2=[]
+W=75, T=Q1, N1=B, P1=[], N2=C P2=[K1]`
+	s, err = parseMovement(strings.NewReader(waiting), problem, Objective{})
+	require.NoError(t, err)
+	assert.Equal(t, 85.0, s.Energy())
+
+	// The package is dropped off where it was picked up, and never reaches its destination
+	wrong := `W=0, T=Q1, N1=B, P1=[], N2=A P2=[]
+W=30, T=Q1, N1=A, P1=[K1], N2=B P2=[K1]`
+	_, err = parseMovement(strings.NewReader(wrong), problem, Objective{})
+	assert.ErrorContains(t, err, "drops off package K1 at B instead of C")
+	assert.ErrorContains(t, err, "package K1 is not delivered")
+
+	_, err = parseMovement(strings.NewReader("W=0, T=Q1, N1=A, P1=[], N2=C P2=[]"), problem, Objective{})
+	assert.ErrorContains(t, err, "no edge between A and C")
+
+	// A solution of the exported model, in the format of HiGHS and of CBC
+	for _, solution := range []string{
+		"Columns 3\nx_0_s_p0 1\nx_0_p0_d0 1\nx_0_d0_e 1\nx_0_s_e 0\nt_0_p0 31\n",
+		"Optimal - objective value 70\n      0 x_0_s_p0 1 30\n      1 x_0_p0_d0 1 40\n      2 x_0_d0_e 1 0\n",
+	} {
+		s, err = parseSolution(strings.NewReader(solution), problem, Objective{})
+		require.NoError(t, err)
+		assert.Equal(t, 70.0, s.Energy())
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.txt")
+	require.NoError(t, os.WriteFile(path, []byte(schedule), 0o644))
+	s, err = importPlan(path, problem, Objective{Kind: Makespan})
+	require.NoError(t, err)
+	assert.Equal(t, 70.0, s.Energy())
+}
+
+func TestRoutingPolicy(t *testing.T) {
+	problem, err := loader.Initialize("test/test4.txt")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	c, _ := problem.Network.ID("C")
+	b, _ := problem.Network.ID("B")
+	names := func(path []int) []string {
+		named := make([]string, len(path))
+		for i, id := range path {
+			named[i] = problem.Network.Name(id)
+		}
+		return named
+	}
+	time := func(path []int) int {
+		total := 0
+		for i := 0; i < len(path)-1; i++ {
+			w, ok := problem.Network.Weight(path[i], path[i+1])
+			require.True(t, ok)
+			total += w
+		}
+		return total
+	}
+
+	leg := func(router Router, start, end int) []int {
+		path, _ := router.leg(start, end, -1, rng)
+		return path
+	}
+
+	router := newRouter(problem, ShortestPath)
+	assert.Equal(t, []string{"C", "A", "B"}, names(leg(router, c, b)))
+
+	// There are only two loopless paths from C to B, the shortest comes first
+	router = newRouter(problem, KShortestPaths)
+	paths := router.kShortest(c, b, 3)
+	require.Len(t, paths, 2)
+	assert.Equal(t, []string{"C", "A", "B"}, names(paths[0]))
+	assert.Equal(t, []string{"C", "E", "D", "B"}, names(paths[1]))
+	assert.Less(t, time(paths[0]), time(paths[1]))
+	assert.Contains(t, paths, leg(router, c, b))
+
+	// On a larger graph the paths still come shortest first and never visit a station twice
+	problem, err = loader.Initialize("test/test3.txt")
+	require.NoError(t, err)
+	router = newRouter(problem, KShortestPaths)
+	a, _ := problem.Network.ID("A")
+	e, _ := problem.Network.ID("E")
+	paths = router.kShortest(a, e, 5)
+	require.NotEmpty(t, paths)
+	for i, path := range paths {
+		seen := make(map[int]bool)
+		for _, id := range path {
+			assert.False(t, seen[id], "loop in %v", names(path))
+			seen[id] = true
+		}
+		if i > 0 {
+			assert.LessOrEqual(t, time(paths[i-1]), time(path))
+		}
+	}
+
+	router = newRouter(problem, RandomPath)
+	path := leg(router, c, b)
+	assert.Equal(t, c, path[0])
+	assert.Equal(t, b, path[len(path)-1])
+
+	_, err = ParseRoutingPolicy("scenic")
+	assert.Error(t, err)
+}
+
+func TestReroute(t *testing.T) {
+	problem, err := loader.Initialize("test/test3.txt")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	router := newRouter(problem, KShortestPaths)
+	s, err := newState(problem, Objective{}, router, rng)
+	require.NoError(t, err)
+
+	legPath := func(s State, train string, leg int) int {
+		for _, each := range s.Move {
+			if each.Train == train && each.Leg == leg {
+				return each.Path
+			}
+		}
+		return -1
+	}
+	switched := 0
+	for i := 0; i < 100; i++ {
+		next, move := s.reroute(rng)
+		if move.Key == "" {
+			continue
+		}
+		switched++
+		var train string
+		var leg, path int
+		_, err := fmt.Sscanf(move.Key, "route %s %d %d", &train, &leg, &path)
+		require.NoError(t, err)
+
+		// The leg follows the new path and every package is still delivered
+		assert.Equal(t, path, legPath(next, train, leg))
+		assert.NotEqual(t, path, legPath(s, train, leg))
+		assert.NoError(t, checkPlan(next))
+		for _, each := range s.Move {
+			if each.Train != train {
+				assert.Contains(t, next.Move, each)
+			}
+		}
+
+		// Planning again with the recorded paths gives the same route
+		_, replanned, err := planLegs(router, next.TrainAssignment, next.Deferred, next.Train, next.legChoices(sortedKeys(next.Train)...), rng)
+		require.NoError(t, err)
+		assert.Equal(t, next.Move, replanned)
+		s = next
+	}
+	assert.NotZero(t, switched)
+}
+
+func TestNeighborKeepsPaths(t *testing.T) {
+	problem, err := loader.Initialize("test/test2.txt")
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	s, err := newState(problem, Objective{}, newRouter(problem, KShortestPaths), rng)
+	require.NoError(t, err)
+
+	// Only the reroute move picks another path. The other moves keep the path between the stations a train joined
+	// before, and take the first path between stations it did not.
+	for i := 0; i < 500; i++ {
+		next, move := s.NeighborMove(rng)
+		n := next.(State)
+		if !strings.HasPrefix(move.Key, "route") {
+			trains := sortedKeys(s.Train)
+			before, after := s.legChoices(trains...), n.legChoices(trains...)
+			for _, train := range trains {
+				for stops, path := range after[train] {
+					if choice, ok := before[train][stops]; ok {
+						assert.Equal(t, choice, path, move.Key)
+					} else {
+						assert.Zero(t, path, move.Key)
+					}
+				}
+			}
+		}
+		s = n
+	}
 }
@@ -0,0 +1,70 @@
+package mip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Number of terms written on a line, the LP format limits the length of a line
+const termsPerLine = 8
+
+// WriteLP writes the model in the CPLEX LP format
+func (m Model) WriteLP(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "\\ %s\n", m.Name)
+	for _, c := range m.Comments {
+		fmt.Fprintf(b, "\\ %s\n", c)
+	}
+
+	fmt.Fprintln(b, "Minimize")
+	fmt.Fprintf(b, " obj: %s\n", lpTerms(m.objective()))
+
+	fmt.Fprintln(b, "Subject To")
+	for _, c := range m.Constraints {
+		fmt.Fprintf(b, " %s: %s %s %s\n", c.Name, lpTerms(c.Terms), c.Sense, number(c.RHS))
+	}
+
+	fmt.Fprintln(b, "Bounds")
+	for _, v := range m.Vars {
+		if !v.Binary {
+			fmt.Fprintf(b, " %s <= %s <= %s\n", number(v.Lower), v.Name, number(v.Upper))
+		}
+	}
+
+	fmt.Fprintln(b, "Binaries")
+	for _, v := range m.Vars {
+		if v.Binary {
+			fmt.Fprintf(b, " %s\n", v.Name)
+		}
+	}
+	fmt.Fprintln(b, "End")
+	return b.Flush()
+}
+
+// Sum of the terms, wrapped over several lines
+func lpTerms(terms []Term) string {
+	var sb strings.Builder
+	for i, t := range terms {
+		switch {
+		case i > 0 && i%termsPerLine == 0:
+			sb.WriteString("\n   ")
+		case i > 0:
+			sb.WriteString(" ")
+		}
+		sign := "+"
+		coef := t.Coef
+		if coef < 0 {
+			sign, coef = "-", -coef
+		}
+		if i > 0 || sign == "-" {
+			sb.WriteString(sign + " ")
+		}
+		if coef != 1 {
+			sb.WriteString(number(coef) + " ")
+		}
+		sb.WriteString(t.Var)
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package mip
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	m := Model{
+		Name:      "small",
+		Comments:  []string{"x and y are binary"},
+		Objective: []Term{{Coef: 2, Var: "x"}, {Coef: -1, Var: "y"}, {Coef: 0, Var: "z"}},
+		Constraints: []Constraint{
+			{Name: "one", Terms: []Term{{Coef: 1, Var: "x"}, {Coef: 1, Var: "y"}}, Sense: Equal, RHS: 1},
+			{Name: "limit", Terms: []Term{{Coef: 3, Var: "x"}, {Coef: -1, Var: "z"}}, Sense: LessOrEqual, RHS: 0},
+		},
+		Vars: []Var{{Name: "x", Binary: true}, {Name: "y", Binary: true}, {Name: "z", Lower: 1, Upper: 5.5}},
+	}
+
+	var lp bytes.Buffer
+	require.NoError(t, m.WriteLP(&lp))
+	assert.Equal(t, `\ small
+\ x and y are binary
+Minimize
+ obj: 2 x - y
+Subject To
+ one: x + y = 1
+ limit: 3 x - z <= 0
+Bounds
+ 1 <= z <= 5.5
+Binaries
+ x
+ y
+End
+`, lp.String())
+
+	var mps bytes.Buffer
+	require.NoError(t, m.WriteMPS(&mps))
+	assert.Equal(t, `* small
+* x and y are binary
+NAME small
+ROWS
+ N obj
+ E one
+ L limit
+COLUMNS
+    MARKER 'MARKER' 'INTORG'
+    x obj 2
+    x one 1
+    x limit 3
+    y obj -1
+    y one 1
+    MARKER 'MARKER' 'INTEND'
+    z limit -1
+RHS
+    RHS one 1
+BOUNDS
+ BV BND x
+ BV BND y
+ LO BND z 1
+ UP BND z 5.5
+ENDATA
+`, mps.String())
+}
@@ -0,0 +1,92 @@
+package mip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type Sense string
+
+const (
+	LessOrEqual    Sense = "<="
+	GreaterOrEqual Sense = ">="
+	Equal          Sense = "="
+)
+
+type Var struct {
+	Name   string
+	Binary bool
+	// Bounds of a continuous variable, binary variables are within [0, 1]
+	Lower float64
+	Upper float64
+}
+
+// Term is a variable with its coefficient
+type Term struct {
+	Coef float64
+	Var  string
+}
+
+type Constraint struct {
+	Name  string
+	Terms []Term
+	Sense Sense
+	RHS   float64
+}
+
+// Model is a mixed integer linear program, minimising the objective subject to the constraints
+type Model struct {
+	Name string
+	// Lines written as comments at the top of the files, to explain the variable names
+	Comments    []string
+	Objective   []Term
+	Constraints []Constraint
+	Vars        []Var
+}
+
+func (m *Model) addVar(v Var) string {
+	m.Vars = append(m.Vars, v)
+	return v.Name
+}
+
+func (m *Model) addConstraint(sense Sense, rhs float64, terms []Term, format string, args ...any) {
+	m.Constraints = append(m.Constraints, Constraint{Name: fmt.Sprintf(format, args...), Terms: terms, Sense: sense, RHS: rhs})
+}
+
+// Objective terms with a coefficient, and a single zero term when there is none as the formats need at least one
+func (m Model) objective() []Term {
+	terms := make([]Term, 0, len(m.Objective))
+	for _, t := range m.Objective {
+		if t.Coef != 0 {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 && len(m.Vars) > 0 {
+		terms = append(terms, Term{Var: m.Vars[0].Name})
+	}
+	return terms
+}
+
+// Coefficients of every variable in the objective and the constraints, by row name
+func (m Model) columns(objective string) map[string][]Term {
+	columns := make(map[string][]Term, len(m.Vars))
+	for _, t := range m.objective() {
+		columns[t.Var] = append(columns[t.Var], Term{Coef: t.Coef, Var: objective})
+	}
+	for _, c := range m.Constraints {
+		for _, t := range c.Terms {
+			columns[t.Var] = append(columns[t.Var], Term{Coef: t.Coef, Var: c.Name})
+		}
+	}
+	for _, terms := range columns {
+		sort.SliceStable(terms, func(i, j int) bool {
+			return terms[i].Var == objective && terms[j].Var != objective
+		})
+	}
+	return columns
+}
+
+func number(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,68 @@
+package mip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Name of the objective row in the MPS format
+const objectiveRow = "obj"
+
+// WriteMPS writes the model in the free MPS format
+func (m Model) WriteMPS(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "* %s\n", m.Name)
+	for _, c := range m.Comments {
+		fmt.Fprintf(b, "* %s\n", c)
+	}
+	fmt.Fprintf(b, "NAME %s\n", m.Name)
+
+	fmt.Fprintln(b, "ROWS")
+	fmt.Fprintf(b, " N %s\n", objectiveRow)
+	for _, c := range m.Constraints {
+		fmt.Fprintf(b, " %s %s\n", map[Sense]string{LessOrEqual: "L", GreaterOrEqual: "G", Equal: "E"}[c.Sense], c.Name)
+	}
+
+	// Binary variables are enclosed in integer markers
+	fmt.Fprintln(b, "COLUMNS")
+	columns := m.columns(objectiveRow)
+	integer := false
+	for _, v := range m.Vars {
+		if v.Binary != integer {
+			marker := "INTORG"
+			if integer {
+				marker = "INTEND"
+			}
+			fmt.Fprintf(b, "    MARKER 'MARKER' '%s'\n", marker)
+			integer = v.Binary
+		}
+		for _, t := range columns[v.Name] {
+			fmt.Fprintf(b, "    %s %s %s\n", v.Name, t.Var, number(t.Coef))
+		}
+	}
+	if integer {
+		fmt.Fprintln(b, "    MARKER 'MARKER' 'INTEND'")
+	}
+
+	fmt.Fprintln(b, "RHS")
+	for _, c := range m.Constraints {
+		if c.RHS != 0 {
+			fmt.Fprintf(b, "    RHS %s %s\n", c.Name, number(c.RHS))
+		}
+	}
+
+	fmt.Fprintln(b, "BOUNDS")
+	for _, v := range m.Vars {
+		if v.Binary {
+			fmt.Fprintf(b, " BV BND %s\n", v.Name)
+			continue
+		}
+		if v.Lower != 0 {
+			fmt.Fprintf(b, " LO BND %s %s\n", v.Name, number(v.Lower))
+		}
+		fmt.Fprintf(b, " UP BND %s %s\n", v.Name, number(v.Upper))
+	}
+	fmt.Fprintln(b, "ENDATA")
+	return b.Flush()
+}
@@ -0,0 +1,157 @@
+package mip
+
+import (
+	"fmt"
+	"solution2/types"
+	"sort"
+)
+
+// Node of the route of a train in the model: its start, the pickup or delivery of a package, or its end
+type node struct {
+	label   string
+	station string
+	// Index of the package picked up or delivered at the node, -1 for the start and end of the route
+	pkg      int
+	delivery bool
+}
+
+// Build turns the problem into a pickup and delivery model.
+// Every train k leaves its start node s, visits the pickup node p<i> and delivery node d<i> of every package i
+// assigned to it, and finishes at its end node e. The variables are
+//   - x_k_<from>_<to>, 1 when train k travels from one node to the next
+//   - y_k_i, 1 when package i is assigned to train k
+//   - t_k_<node>, the time train k arrives at the node, plus one for every node visited before it so that routes
+//     along arcs of no travel time cannot go round in circles
+//   - makespan, the time of the slowest train
+//
+// Trains and packages are numbered in the order of their names, the comments of the model list them.
+// distance gives the travel time between two stations, a train can carry all its packages at once as long as
+// their weight does not exceed its capacity. The objective is the total route time of the trains, blended with
+// the makespan by makespanWeight between 0 (only total time) and 1 (only makespan).
+func Build(problem types.Problem, distance func(from, to string) int, makespanWeight float64) Model {
+	trains := sortedKeys(problem.Train)
+	pkgs := sortedKeys(problem.Package)
+
+	m := Model{Name: "train_delivery"}
+	for k, t := range trains {
+		m.Comments = append(m.Comments, fmt.Sprintf("train %d: %s", k, t))
+	}
+	for i, p := range pkgs {
+		m.Comments = append(m.Comments, fmt.Sprintf("package %d: %s", i, p))
+	}
+
+	// Upper bound on the time of any route, which visits every node once along the longest arcs
+	nodes := make([]node, 0, 2*len(pkgs))
+	for i, name := range pkgs {
+		p := problem.Package[name]
+		nodes = append(nodes, node{label: fmt.Sprintf("p%d", i), station: p.StartAt, pkg: i}, node{label: fmt.Sprintf("d%d", i), station: p.Destination, pkg: i, delivery: true})
+	}
+	horizon := len(nodes) + 2
+	for _, from := range append(nodes, trainNodes(problem, trains)...) {
+		longest := 0
+		for _, to := range nodes {
+			if d := distance(from.station, to.station); d > longest {
+				longest = d
+			}
+		}
+		horizon += longest
+	}
+
+	makespan := m.addVar(Var{Name: "makespan", Upper: float64(horizon)})
+	m.Objective = append(m.Objective, Term{Coef: makespanWeight, Var: makespan})
+
+	assigned := make([][]string, len(trains))
+	for k, t := range trains {
+		start := node{label: "s", station: problem.Train[t].StartAt, pkg: -1}
+		end := node{label: "e", pkg: -1}
+		route := append(append([]node{start}, nodes...), end)
+
+		// Arrival times, the route starts at 0
+		arrival := make(map[string]string, len(route))
+		for _, n := range route {
+			upper := float64(horizon)
+			if n.label == "s" {
+				upper = 0
+			}
+			arrival[n.label] = m.addVar(Var{Name: fmt.Sprintf("t_%d_%s", k, n.label), Upper: upper})
+		}
+
+		// Arcs between the nodes, a route never returns to its start, never leaves its end and never delivers a
+		// package before picking it up
+		out := make(map[string][]Term)
+		in := make(map[string][]Term)
+		routeTime := make([]Term, 0)
+		for _, from := range route[:len(route)-1] {
+			for _, to := range route[1:] {
+				if from.label == to.label || (from.delivery && !to.delivery && from.pkg == to.pkg) || (from.label == "s" && to.delivery) {
+					continue
+				}
+				cost := 0
+				if to.label != "e" {
+					cost = distance(from.station, to.station)
+				}
+
+				x := m.addVar(Var{Name: fmt.Sprintf("x_%d_%s_%s", k, from.label, to.label), Binary: true})
+				out[from.label] = append(out[from.label], Term{Coef: 1, Var: x})
+				in[to.label] = append(in[to.label], Term{Coef: 1, Var: x})
+				if cost > 0 {
+					routeTime = append(routeTime, Term{Coef: float64(cost), Var: x})
+					m.Objective = append(m.Objective, Term{Coef: (1 - makespanWeight) * float64(cost), Var: x})
+				}
+
+				// Arriving at the next node later than the travel time after the previous one, when the arc is used
+				m.addConstraint(GreaterOrEqual, float64(cost+1-horizon), []Term{{Coef: 1, Var: arrival[to.label]}, {Coef: -1, Var: arrival[from.label]}, {Coef: -float64(horizon), Var: x}},
+					"time_%d_%s_%s", k, from.label, to.label)
+			}
+		}
+
+		m.addConstraint(Equal, 1, out["s"], "leave_%d", k)
+		m.addConstraint(Equal, 1, in["e"], "finish_%d", k)
+		for i := range pkgs {
+			y := m.addVar(Var{Name: fmt.Sprintf("y_%d_%d", k, i), Binary: true})
+			assigned[k] = append(assigned[k], y)
+			for _, label := range []string{fmt.Sprintf("p%d", i), fmt.Sprintf("d%d", i)} {
+				m.addConstraint(Equal, 0, append(out[label], Term{Coef: -1, Var: y}), "out_%d_%s", k, label)
+				m.addConstraint(Equal, 0, append(in[label], Term{Coef: -1, Var: y}), "in_%d_%s", k, label)
+			}
+			m.addConstraint(GreaterOrEqual, 0, []Term{{Coef: 1, Var: arrival[fmt.Sprintf("d%d", i)]}, {Coef: -1, Var: arrival[fmt.Sprintf("p%d", i)]}},
+				"precedence_%d_%d", k, i)
+		}
+
+		m.addConstraint(LessOrEqual, 0, append(routeTime, Term{Coef: -1, Var: makespan}), "makespan_%d", k)
+	}
+
+	for k, t := range trains {
+		terms := make([]Term, 0, len(pkgs))
+		for i, name := range pkgs {
+			terms = append(terms, Term{Coef: float64(problem.Package[name].Weight), Var: assigned[k][i]})
+		}
+		m.addConstraint(LessOrEqual, float64(problem.Train[t].Capacity), terms, "capacity_%d", k)
+	}
+	for i := range pkgs {
+		terms := make([]Term, 0, len(trains))
+		for k := range trains {
+			terms = append(terms, Term{Coef: 1, Var: assigned[k][i]})
+		}
+		m.addConstraint(Equal, 1, terms, "assign_%d", i)
+	}
+	return m
+}
+
+// Start nodes of the trains
+func trainNodes(problem types.Problem, trains []string) []node {
+	nodes := make([]node, 0, len(trains))
+	for _, t := range trains {
+		nodes = append(nodes, node{label: "s", station: problem.Train[t].StartAt, pkg: -1})
+	}
+	return nodes
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type ObjectiveKind int
+
+const (
+	// Sum of the route time of every train, as if the trains ran one after another
+	TotalTime ObjectiveKind = iota
+	// Time until the last train finishes, the trains run in parallel
+	Makespan
+	// Blend of makespan and total time
+	Weighted
+)
+
+// Objective decides how the route time of every train is turned into the energy of a state
+type Objective struct {
+	Kind ObjectiveKind
+	// Share of the makespan in the Weighted objective, the total time takes the rest
+	MakespanWeight float64
+}
+
+// ParseObjective turns the name of an objective into an Objective
+func ParseObjective(name string, makespanWeight float64) (Objective, error) {
+	switch name {
+	case "total":
+		return Objective{Kind: TotalTime}, nil
+	case "makespan":
+		return Objective{Kind: Makespan}, nil
+	case "weighted":
+		if makespanWeight < 0 || makespanWeight > 1 {
+			return Objective{}, fmt.Errorf("makespan weight %v is not within [0, 1]", makespanWeight)
+		}
+		return Objective{Kind: Weighted, MakespanWeight: makespanWeight}, nil
+	}
+	return Objective{}, fmt.Errorf("unknown objective %q", name)
+}
+
+// Evaluate combines the time taken by each train into a single value
+func (o Objective) Evaluate(timeTaken map[string]int) float64 {
+	var total, makespan float64
+	for _, t := range timeTaken {
+		total += float64(t)
+		makespan = math.Max(makespan, float64(t))
+	}
+
+	switch o.Kind {
+	case Makespan:
+		return makespan
+	case Weighted:
+		return o.MakespanWeight*makespan + (1-o.MakespanWeight)*total
+	}
+	return total
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"solution2/graph"
+	"solution2/types"
+	"strconv"
+	"strings"
+)
+
+// Line of a dispatch schedule as printed by PrintMovement, the comma before P2 is optional
+var movementLine = regexp.MustCompile(`^W=(\d+),\s*T=([^,\s]+),\s*N1=([^,\s]+),\s*P1=\[([^\]]*)\],\s*N2=([^,\s]+),?\s*P2=\[([^\]]*)\]$`)
+
+// Name of an arc variable of the MIP model, x_<train>_<from>_<to>
+var arcVariable = regexp.MustCompile(`^x_(\d+)_(s|[pd]\d+)_(e|[pd]\d+)$`)
+
+// importPlan reads a plan made outside of the program, checks it against the problem and returns it as a state scored
+// with the objective. The plan is either a dispatch schedule in the format printed by PrintMovement, or a solution file
+// of the model written by -export, in which case the trains follow the shortest paths between their stops.
+func importPlan(path string, problem types.Problem, objective Objective) (State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+	if strings.Contains(string(data), "W=") {
+		return parseMovement(strings.NewReader(string(data)), problem, objective)
+	}
+	return parseSolution(strings.NewReader(string(data)), problem, objective)
+}
+
+// Parse a dispatch schedule, lines starting with // are comments
+func parseMovement(r io.Reader, problem types.Problem, objective Objective) (State, error) {
+	s := State{
+		TrainAssignment: make(map[string][]string),
+		Route:           make(map[string][]string),
+		Move:            make([]Move, 0),
+		Router:          newRouter(problem, ShortestPath),
+		Train:           problem.Train,
+		Package:         problem.Package,
+		Objective:       objective,
+	}
+	for t := range problem.Train {
+		s.TrainAssignment[t] = []string{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		match := movementLine.FindStringSubmatch(text)
+		if match == nil {
+			return State{}, fmt.Errorf("line %d: %q is not a move", line, text)
+		}
+
+		m := Move{Train: match[2], StartNode: match[3], EndNode: match[5], PickedPackage: packageList(match[4]), DroppedPackage: packageList(match[6])}
+		m.Start, _ = strconv.Atoi(match[1])
+		if _, ok := problem.Train[m.Train]; !ok {
+			return State{}, fmt.Errorf("line %d: unknown train %s", line, m.Train)
+		}
+		weight, ok := problem.Graph[m.StartNode][m.EndNode]
+		if !ok {
+			return State{}, fmt.Errorf("line %d: no edge between %s and %s", line, m.StartNode, m.EndNode)
+		}
+		m.End = m.Start + weight
+
+		if len(s.Route[m.Train]) == 0 {
+			s.Route[m.Train] = []string{m.StartNode}
+		}
+		s.Route[m.Train] = append(s.Route[m.Train], m.EndNode)
+		s.TrainAssignment[m.Train] = append(s.TrainAssignment[m.Train], m.PickedPackage...)
+		s.Move = append(s.Move, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return State{}, err
+	}
+
+	sortMoves(s.Move)
+	return s, checkPlan(s)
+}
+
+// Packages of a list printed with %v, separated by spaces or commas
+func packageList(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+// Parse a solution file of the exported model. Solvers write the value of a variable after its name on the same
+// line, so any line holding an arc variable followed by a number is read and everything else is skipped.
+func parseSolution(r io.Reader, problem types.Problem, objective Objective) (State, error) {
+	trains := sortedKeys(problem.Train)
+	pkgs := sortedKeys(problem.Package)
+
+	// Stop following each stop of every train
+	next := make(map[string]map[string]string, len(trains))
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 0; i < len(fields)-1; i++ {
+			match := arcVariable.FindStringSubmatch(fields[i])
+			if match == nil {
+				continue
+			}
+			value, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil || value < 0.5 {
+				continue
+			}
+			k, _ := strconv.Atoi(match[1])
+			if k >= len(trains) {
+				return State{}, fmt.Errorf("unknown train %d in variable %s", k, fields[i])
+			}
+			if next[trains[k]] == nil {
+				next[trains[k]] = make(map[string]string)
+			}
+			next[trains[k]][match[2]] = match[3]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return State{}, err
+	}
+	if len(next) == 0 {
+		return State{}, fmt.Errorf("no route found in the solution")
+	}
+
+	events := make(map[string][]event, len(trains))
+	for _, t := range trains {
+		// Follow the route from the start to the end, it visits every stop once at most
+		stop := "s"
+		for i := 0; i <= 2*len(pkgs); i++ {
+			stop = next[t][stop]
+			if stop == "" || stop == "e" {
+				break
+			}
+			p, err := strconv.Atoi(stop[1:])
+			if err != nil || p >= len(pkgs) {
+				return State{}, fmt.Errorf("unknown package %s in the route of train %s", stop, t)
+			}
+			events[t] = append(events[t], event{pkg: pkgs[p], drop: stop[0] == 'd'})
+		}
+		if stop != "e" && next[t] != nil {
+			return State{}, fmt.Errorf("the route of train %s does not end", t)
+		}
+	}
+
+	s := eventState(problem, graph.ForNetwork(problem.Graph, problem.Network), events, objective)
+	return s, checkPlan(s)
+}
+
+// checkPlan checks that every train moves on from where it stopped, picks up packages at their station without
+// exceeding its capacity, and drops them off at their destination, and that every package is delivered.
+// It reports every problem found.
+func checkPlan(s State) error {
+	var errs []error
+	location := make(map[string]string, len(s.Train))
+	clock := make(map[string]int, len(s.Train))
+	load := make(map[string]int, len(s.Train))
+	// Train carrying each package, and whether it was delivered
+	carrier := make(map[string]string)
+	delivered := make(map[string]bool)
+	for name, t := range s.Train {
+		location[name] = t.StartAt
+	}
+
+	for _, m := range s.Move {
+		if location[m.Train] != m.StartNode {
+			errs = append(errs, fmt.Errorf("train %s leaves %s at %d but is at %s", m.Train, m.StartNode, m.Start, location[m.Train]))
+		}
+		if m.Start < clock[m.Train] {
+			errs = append(errs, fmt.Errorf("train %s leaves %s at %d before arriving at %d", m.Train, m.StartNode, m.Start, clock[m.Train]))
+		}
+		for _, p := range m.PickedPackage {
+			pkg, ok := s.Package[p]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("train %s picks up unknown package %s", m.Train, p))
+				continue
+			case carrier[p] != "" || delivered[p]:
+				errs = append(errs, fmt.Errorf("train %s picks up package %s again", m.Train, p))
+				continue
+			case pkg.StartAt != m.StartNode:
+				errs = append(errs, fmt.Errorf("train %s picks up package %s at %s instead of %s", m.Train, p, m.StartNode, pkg.StartAt))
+			}
+			carrier[p] = m.Train
+			load[m.Train] += pkg.Weight
+			if load[m.Train] > s.Train[m.Train].Capacity {
+				errs = append(errs, fmt.Errorf("train %s carries %d, more than its capacity of %d", m.Train, load[m.Train], s.Train[m.Train].Capacity))
+			}
+		}
+
+		location[m.Train] = m.EndNode
+		clock[m.Train] = m.End
+		for _, p := range m.DroppedPackage {
+			if carrier[p] != m.Train {
+				errs = append(errs, fmt.Errorf("train %s drops off package %s which it does not carry", m.Train, p))
+				continue
+			}
+			delete(carrier, p)
+			load[m.Train] -= s.Package[p].Weight
+			if s.Package[p].Destination != m.EndNode {
+				errs = append(errs, fmt.Errorf("train %s drops off package %s at %s instead of %s", m.Train, p, m.EndNode, s.Package[p].Destination))
+				continue
+			}
+			delivered[p] = true
+		}
+	}
+
+	for _, p := range sortedKeys(s.Package) {
+		if !delivered[p] {
+			errs = append(errs, fmt.Errorf("package %s is not delivered", p))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,40 +1,91 @@
 package pqueue
 
-type Node struct {
-	Name     string
-	Duration int
-	index    int
+import "container/heap"
+
+// IndexedPQ is a min heap of node IDs from 0 to n-1 keyed by their duration. It knows where every node is in the
+// heap, so the key of a queued node is lowered in O(log n) without searching for it.
+type IndexedPQ struct {
+	h indexedHeap
+}
+
+// Heap of node IDs with their position and key by ID, -1 as position for the nodes which are not queued
+type indexedHeap struct {
+	ids []int
+	pos []int
+	key []int
+}
+
+func (h indexedHeap) Len() int {
+	return len(h.ids)
+}
+
+// Ties are broken by ID so that the order does not depend on the order of the pushes
+func (h indexedHeap) Less(i, j int) bool {
+	a, b := h.ids[i], h.ids[j]
+	if h.key[a] != h.key[b] {
+		return h.key[a] < h.key[b]
+	}
+	return a < b
 }
 
-// Min heap
-type DistancePQ []*Node
+func (h indexedHeap) Swap(i, j int) {
+	h.ids[i], h.ids[j] = h.ids[j], h.ids[i]
+	h.pos[h.ids[i]] = i
+	h.pos[h.ids[j]] = j
+}
 
-func (pq DistancePQ) Len() int {
-	return len(pq)
+func (h *indexedHeap) Push(id any) {
+	h.pos[id.(int)] = len(h.ids)
+	h.ids = append(h.ids, id.(int))
 }
 
-func (pq DistancePQ) Less(i, j int) bool {
-	return pq[i].Duration < pq[j].Duration
+func (h *indexedHeap) Pop() any {
+	id := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	h.pos[id] = -1
+	return id
 }
 
-func (pq DistancePQ) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].index = i
-	pq[j].index = j
+// NewIndexedPQ creates an empty queue for the node IDs from 0 to n-1
+func NewIndexedPQ(n int) *IndexedPQ {
+	pq := &IndexedPQ{h: indexedHeap{ids: make([]int, 0, n), pos: make([]int, n), key: make([]int, n)}}
+	for i := range pq.h.pos {
+		pq.h.pos[i] = -1
+	}
+	return pq
 }
 
-func (pq *DistancePQ) Pop() any {
-	old := *pq
-	item := old[len(old)-1]
-	old[len(old)-1] = nil
-	item.index = -1
-	*pq = old[:len(old)-1]
+func (pq *IndexedPQ) Len() int {
+	return pq.h.Len()
+}
+
+// Contains tells whether the node is queued
+func (pq *IndexedPQ) Contains(id int) bool {
+	return pq.h.pos[id] >= 0
+}
+
+// Key of a queued node
+func (pq *IndexedPQ) Key(id int) int {
+	return pq.h.key[id]
+}
+
+// Push queues a node which is not queued yet
+func (pq *IndexedPQ) Push(id, key int) {
+	pq.h.key[id] = key
+	heap.Push(&pq.h, id)
+}
 
-	return item
+// DecreaseKey lowers the key of a queued node, a higher key is ignored
+func (pq *IndexedPQ) DecreaseKey(id, key int) {
+	if key >= pq.h.key[id] {
+		return
+	}
+	pq.h.key[id] = key
+	heap.Fix(&pq.h, pq.h.pos[id])
 }
 
-func (pq *DistancePQ) Push(node any) {
-	i := node.(*Node)
-	i.index = len(*pq)
-	*pq = append(*pq, i)
+// Pop removes the node with the lowest key and returns it with its key
+func (pq *IndexedPQ) Pop() (int, int) {
+	id := heap.Pop(&pq.h).(int)
+	return id, pq.h.key[id]
 }
@@ -0,0 +1,45 @@
+package pqueue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexedPQ(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	pq := NewIndexedPQ(100)
+	keys := make([]int, 100)
+	for id := range keys {
+		keys[id] = r.Intn(1000)
+		pq.Push(id, keys[id])
+	}
+
+	// Lower half of the keys, and try to raise the others which is ignored
+	for id := range keys {
+		if id%2 == 0 {
+			keys[id] /= 2
+		}
+		pq.DecreaseKey(id, keys[id]+id%2)
+		assert.Equal(t, keys[id], pq.Key(id))
+	}
+
+	// Nodes come out by key, then by ID
+	order := make([]int, 100)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return keys[order[i]] < keys[order[j]]
+	})
+	for _, expected := range order {
+		assert.True(t, pq.Contains(expected))
+		id, key := pq.Pop()
+		assert.Equal(t, expected, id)
+		assert.Equal(t, keys[expected], key)
+		assert.False(t, pq.Contains(id))
+	}
+	assert.Equal(t, 0, pq.Len())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"solution2/graph"
+	"solution2/types"
+)
+
+// RoutingPolicy decides which path a train takes between two stops
+type RoutingPolicy int
+
+const (
+	// Always a shortest path
+	ShortestPath RoutingPolicy = iota
+	// One of the K shortest loopless paths, picked at random
+	KShortestPaths
+	// The path found by a randomly shuffled depth first search, which can make long detours
+	RandomPath
+)
+
+// Routing policy of the -routing flag when none is given
+const defaultRouting = "shortest"
+
+// ParseRoutingPolicy turns the name of a routing policy into a RoutingPolicy
+func ParseRoutingPolicy(name string) (RoutingPolicy, error) {
+	switch name {
+	case "shortest":
+		return ShortestPath, nil
+	case "k-shortest":
+		return KShortestPaths, nil
+	case "random":
+		return RandomPath, nil
+	}
+	return 0, fmt.Errorf("unknown routing policy %q", name)
+}
+
+// Router plans the legs of the routes, between the stations numbered by the network
+type Router struct {
+	Network  *types.Network
+	Paths    *graph.Graph
+	Packages *packageIndex
+	Policy   RoutingPolicy
+	// Number of paths to pick from with KShortestPaths, defaults to 3
+	K int
+}
+
+func newRouter(problem types.Problem, policy RoutingPolicy) Router {
+	return Router{Network: problem.Network, Paths: graph.ForNetwork(problem.Graph, problem.Network), Packages: newPackageIndex(problem), Policy: policy}
+}
+
+// Packages numbered in sorted name order, with the numbers of their stations
+type packageIndex struct {
+	Number      map[string]int
+	Names       []string
+	StartAt     []int
+	Destination []int
+	// Packages waiting at every station
+	Waiting [][]int
+}
+
+func newPackageIndex(problem types.Problem) *packageIndex {
+	index := &packageIndex{Number: make(map[string]int, len(problem.Package)), Names: sortedKeys(problem.Package)}
+	index.Waiting = make([][]int, problem.Network.Len())
+	for i, name := range index.Names {
+		p := problem.Package[name]
+		index.Number[name] = i
+		startAt, _ := problem.Network.ID(p.StartAt)
+		destination, _ := problem.Network.ID(p.Destination)
+		index.StartAt = append(index.StartAt, startAt)
+		index.Destination = append(index.Destination, destination)
+		index.Waiting[startAt] = append(index.Waiting[startAt], i)
+	}
+	return index
+}
+
+// Path of a leg from one station to another, nil when there is none, and which of the K shortest paths it is.
+// With KShortestPaths the path is the given choice, a random one when the choice is negative, or the shortest
+// when there are fewer paths.
+// The other policies have a single choice 0.
+func (rt Router) leg(start, end, choice int, r *rand.Rand) ([]int, int) {
+	switch rt.Policy {
+	case ShortestPath:
+		return rt.Paths.PathByID(start, end), 0
+	case KShortestPaths:
+		paths := rt.kShortest(start, end, rt.k())
+		if len(paths) == 0 {
+			return nil, 0
+		}
+		if choice < 0 {
+			choice = r.Intn(len(paths))
+		} else if choice >= len(paths) {
+			choice = 0
+		}
+		return paths[choice], choice
+	}
+	return randomGraphTravel(rt.Network, start, end, r), 0
+}
+
+// Whether the train is able to reach the package from its start station. It then reaches the destination as well,
+// which validation checks to be connected to the station of the package.
+func (rt Router) reaches(train *types.Train, pkg *types.Package) bool {
+	return rt.Paths.Distance(train.StartAt, pkg.StartAt) != graph.Unreachable
+}
+
+func (rt Router) k() int {
+	if rt.K <= 0 {
+		return 3
+	}
+	return rt.K
+}
+
+// Up to k shortest loopless paths, shortest first
+func (rt Router) kShortest(start, end, k int) [][]int {
+	return rt.Paths.KShortestPathsByID(start, end, k)
+}
@@ -0,0 +1,100 @@
+package tabu
+
+import (
+	"context"
+	"math/rand"
+	"solution2/anneal"
+	"time"
+)
+
+// Move describes the change that turned a state into its neighbor.
+// Key identifies the move itself and Reverse the move that would undo it, which is what becomes tabu once the move
+// is made. A neighbor which does not change the state has a move with an empty Key.
+type Move struct {
+	Key     string
+	Reverse string
+}
+
+// State is an anneal.State which also reports the move behind each neighbor
+type State interface {
+	anneal.State
+	NeighborMove(r *rand.Rand) (State, Move)
+}
+
+type Config struct {
+	Iteration uint
+	// Number of neighbors sampled in every iteration, defaults to 20
+	Candidates int
+	// Number of iterations a move stays tabu, defaults to 10
+	Tenure uint
+	Seed   int64
+	// Wall clock budget of the run, 0 for no limit
+	TimeBudget time.Duration
+}
+
+// Search runs tabu search from initial and returns the best state found.
+// Every iteration it samples a set of neighbors and moves to the best one whose move is not tabu, even when it is
+// worse than the current state. A tabu move is still taken when it leads to a state better than the best so far
+// (aspiration). Neighbors which do not change the state are no candidates, as they would always beat a worse move.
+// Iterations without any candidate count as rejected.
+func Search(ctx context.Context, initial State, conf Config) anneal.Result {
+	if conf.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.TimeBudget)
+		defer cancel()
+	}
+	if conf.Candidates <= 0 {
+		conf.Candidates = 20
+	}
+	if conf.Tenure == 0 {
+		conf.Tenure = 10
+	}
+
+	r := rand.New(rand.NewSource(conf.Seed))
+	curr := initial
+	best := anneal.Result{State: initial, Energy: initial.Energy()}
+	// Iteration until which a move is tabu
+	tabu := make(map[string]uint)
+
+	for i := uint(1); i <= conf.Iteration; i++ {
+		if ctx.Err() != nil {
+			best.Stopped = true
+			break
+		}
+		best.Stats.Iterations++
+
+		var next State
+		var nextMove Move
+		var nextEnergy float64
+		for c := 0; c < conf.Candidates; c++ {
+			neighbor, move := curr.NeighborMove(r)
+			if move.Key == "" {
+				continue
+			}
+			energy := neighbor.Energy()
+			if tabu[move.Key] >= i && energy >= best.Energy {
+				continue
+			}
+			if next == nil || energy < nextEnergy {
+				next, nextMove, nextEnergy = neighbor, move, energy
+			}
+		}
+
+		if next == nil {
+			best.Stats.Rejected++
+			continue
+		}
+		best.Stats.Accepted++
+		curr = next
+		if nextMove.Reverse != "" {
+			tabu[nextMove.Reverse] = i + conf.Tenure
+		}
+
+		if nextEnergy < best.Energy {
+			best.State = next
+			best.Energy = nextEnergy
+			best.Stats.BestIteration = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,43 @@
+package tabu
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"solution2/anneal"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Station on a line whose neighbors are one step to either side, half of the neighbors stay where they are
+type station int
+
+// Energy of every station, station 1 is a local minimum and station 3 the global one
+var landscape = []float64{4, 1, 3, 0, 2}
+
+func (s station) Energy() float64 {
+	return landscape[s]
+}
+
+func (s station) Neighbor(r *rand.Rand) anneal.State {
+	next, _ := s.NeighborMove(r)
+	return next
+}
+
+func (s station) PrintMovement() {}
+
+func (s station) NeighborMove(r *rand.Rand) (State, Move) {
+	next := s + station(2*r.Intn(2)-1)
+	if r.Intn(2) == 0 || next < 0 || int(next) >= len(landscape) {
+		return s, Move{}
+	}
+	return next, Move{Key: fmt.Sprintf("%d %d", s, next), Reverse: fmt.Sprintf("%d %d", next, s)}
+}
+
+func TestSearchLeavesLocalMinimum(t *testing.T) {
+	// Staying at station 1 always beats going up to station 2, which is the only way to station 3
+	res := Search(context.Background(), station(1), Config{Iteration: 20, Candidates: 10, Seed: 1})
+	assert.Equal(t, station(3), res.State)
+	assert.Equal(t, 0.0, res.Energy)
+}
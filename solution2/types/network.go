@@ -0,0 +1,99 @@
+package types
+
+import "sort"
+
+// Network is the graph with the stations numbered from 0 in the order of their names. The edges leaving each station
+// are stored next to each other in arrays (compressed sparse rows), sorted by the station they lead to, so that the
+// solvers work on integers and only turn them back into names for the output.
+type Network struct {
+	names []string
+	ids   map[string]int
+	// Edges leaving station i are target[offset[i]:offset[i+1]] with the same weights
+	offset []int
+	target []int
+	weight []int
+}
+
+// NewNetwork numbers the stations of the graph and packs its edges
+func NewNetwork(g Graph) *Network {
+	names := make(map[string]bool, len(g))
+	for from, to := range g {
+		names[from] = true
+		for station := range to {
+			names[station] = true
+		}
+	}
+
+	n := &Network{names: make([]string, 0, len(names)), ids: make(map[string]int, len(names))}
+	for name := range names {
+		n.names = append(n.names, name)
+	}
+	sort.Strings(n.names)
+	for i, name := range n.names {
+		n.ids[name] = i
+	}
+
+	n.offset = make([]int, len(n.names)+1)
+	for i, name := range n.names {
+		start := len(n.target)
+		for station, w := range g[name] {
+			n.target = append(n.target, n.ids[station])
+			n.weight = append(n.weight, w)
+		}
+		edges := edgeSlice{target: n.target[start:], weight: n.weight[start:]}
+		sort.Sort(edges)
+		n.offset[i+1] = len(n.target)
+	}
+	return n
+}
+
+// Len is the number of stations
+func (n *Network) Len() int {
+	return len(n.names)
+}
+
+// ID of the station, false when there is no such station
+func (n *Network) ID(name string) (int, bool) {
+	id, ok := n.ids[name]
+	return id, ok
+}
+
+// Name of the station
+func (n *Network) Name(id int) string {
+	return n.names[id]
+}
+
+// Neighbours returns the stations reached by the edges leaving the station and the weights of the edges, sorted by
+// station. The slices are shared and must not be changed.
+func (n *Network) Neighbours(id int) ([]int, []int) {
+	return n.target[n.offset[id]:n.offset[id+1]], n.weight[n.offset[id]:n.offset[id+1]]
+}
+
+// Weight of the edge from one station to another, false when there is none
+func (n *Network) Weight(from, to int) (int, bool) {
+	targets, weights := n.Neighbours(from)
+	i := sort.SearchInts(targets, to)
+	if i == len(targets) || targets[i] != to {
+		return 0, false
+	}
+	return weights[i], true
+}
+
+// Edges of a station, sorted by the station they lead to
+type edgeSlice struct {
+	target []int
+	weight []int
+}
+
+func (e edgeSlice) Len() int {
+	return len(e.target)
+}
+
+func (e edgeSlice) Less(i, j int) bool {
+	return e.target[i] < e.target[j]
+}
+
+func (e edgeSlice) Swap(i, j int) {
+	e.target[i], e.target[j] = e.target[j], e.target[i]
+	e.weight[i], e.weight[j] = e.weight[j], e.weight[i]
+}
@@ -0,0 +1,34 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetwork(t *testing.T) {
+	n := NewNetwork(Graph{"C": {"A": 3, "B": 1}, "A": {"C": 3}, "B": {"C": 1, "D": 7}})
+	assert.Equal(t, 4, n.Len())
+
+	// Stations are numbered in the order of their names, and stations only reached by an edge are included
+	for i, name := range []string{"A", "B", "C", "D"} {
+		id, ok := n.ID(name)
+		assert.True(t, ok)
+		assert.Equal(t, i, id)
+		assert.Equal(t, name, n.Name(i))
+	}
+	_, ok := n.ID("E")
+	assert.False(t, ok)
+
+	targets, weights := n.Neighbours(2)
+	assert.Equal(t, []int{0, 1}, targets)
+	assert.Equal(t, []int{3, 1}, weights)
+	targets, _ = n.Neighbours(3)
+	assert.Empty(t, targets)
+
+	w, ok := n.Weight(1, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 7, w)
+	_, ok = n.Weight(3, 1)
+	assert.False(t, ok)
+}